@@ -0,0 +1,190 @@
+package main
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// archiveTime is the modification time stored for every archive entry, so
+// the same directory always produces byte-identical archives.
+var archiveTime = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// archiveEntries lists the regular files below directory as sorted
+// slash-separated relative paths. Hidden files and directories are skipped.
+func archiveEntries(directory string) ([]string, error) {
+	var entries []string
+	err := filepath.Walk(directory, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if file != directory && strings.HasPrefix(info.Name(), ".") {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(directory, file)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, filepath.ToSlash(rel))
+		return nil
+	})
+	sort.Strings(entries)
+	return entries, err
+}
+
+// contentHash identifies the entries of a directory by their paths and
+// contents.
+func contentHash(directory string, entries []string) (string, error) {
+	hash := sha256.New()
+	for _, entry := range entries {
+		f, err := os.Open(filepath.Join(directory, filepath.FromSlash(entry)))
+		if err != nil {
+			return "", err
+		}
+		size, err := io.Copy(hash, f)
+		f.Close()
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(hash, "\x00%s\x00%d\x00", entry, size)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// writeZip writes a deterministic zip of entries below directory to output.
+func writeZip(directory string, entries []string, output string) error {
+	out, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	archive := zip.NewWriter(out)
+	for _, entry := range entries {
+		header := &zip.FileHeader{Name: entry, Method: zip.Deflate}
+		header.Modified = archiveTime
+		header.SetMode(0644)
+		writer, err := archive.CreateHeader(header)
+		if err != nil {
+			out.Close()
+			return err
+		}
+		f, err := os.Open(filepath.Join(directory, filepath.FromSlash(entry)))
+		if err != nil {
+			out.Close()
+			return err
+		}
+		_, err = io.Copy(writer, f)
+		f.Close()
+		if err != nil {
+			out.Close()
+			return err
+		}
+	}
+	if err = archive.Close(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func copyFile(source string, destination string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(destination)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// buildArchive zips the directory named by file into outputDir and returns the
+// archive path. When cacheDir is set, archives are kept there by content hash
+// and reused while the directory is unchanged.
+func buildArchive(productDirectory string, file File, outputDir string, cacheDir string) (string, error) {
+	if file.Archive != "zip" {
+		return "", fmt.Errorf("unsupported archive type %q", file.Archive)
+	}
+	directory := filepath.Join(productDirectory, file.Name)
+	info, err := os.Stat(directory)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", file.Name)
+	}
+
+	entries, err := archiveEntries(directory)
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 0 {
+		return "", fmt.Errorf("%s has no files to archive", file.Name)
+	}
+	if err = os.MkdirAll(outputDir, 0755); err != nil {
+		return "", err
+	}
+	output := filepath.Join(outputDir, filepath.Base(filepath.Clean(directory))+".zip")
+
+	if cacheDir == "" {
+		return output, writeZip(directory, entries, output)
+	}
+
+	hash, err := contentHash(directory, entries)
+	if err != nil {
+		return "", err
+	}
+	cached := filepath.Join(cacheDir, hash+".zip")
+	if _, err = os.Stat(cached); err == nil {
+		logger.Debug("Using cached archive", "file", file.Name, "archive", cached)
+		return output, copyFile(cached, output)
+	}
+	if err = os.MkdirAll(cacheDir, 0755); err != nil {
+		return "", err
+	}
+	if err = writeZip(directory, entries, cached+".tmp"); err != nil {
+		os.Remove(cached + ".tmp")
+		return "", err
+	}
+	if err = os.Rename(cached+".tmp", cached); err != nil {
+		return "", err
+	}
+	return output, copyFile(cached, output)
+}
+
+// prepareArchives builds an archive for every file entry that asks for one.
+func prepareArchives(productBundle *ProductBundle, tempDir string, cacheDir string) error {
+	for i := range productBundle.Files {
+		file := &productBundle.Files[i]
+		if file.Archive == "" {
+			continue
+		}
+		// Each entry gets its own directory, so a/scene and b/scene do not
+		// both become scene.zip.
+		archive, err := buildArchive(productBundle.Directory, *file, filepath.Join(tempDir, fmt.Sprintf("file-%d", i)), cacheDir)
+		if err != nil {
+			return fmt.Errorf("archiving %s: %s", file.Name, err)
+		}
+		logger.Info("Archived directory", "file", file.Name, "archive", filepath.Base(archive))
+		file.Source = archive
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// categoryCacheTTL is how long a cached category tree is used before it is
+// fetched again.
+const categoryCacheTTL = 24 * time.Hour
+
+type Category struct {
+	Id       int    `jsonapi:"primary,category" json:"id"`
+	Name     string `jsonapi:"attr,name" json:"name"`
+	ParentId int    `jsonapi:"attr,parent_id,omitempty" json:"parent_id,omitempty"`
+	Path     string `json:"path"`
+}
+
+// CategoryRef is a category in product.json, given either as a numeric ID or
+// as a slash-separated path such as "Furnishings/Chair/Office Chair".
+type CategoryRef string
+
+func (ref *CategoryRef) UnmarshalJSON(data []byte) error {
+	var id int
+	if err := json.Unmarshal(data, &id); err == nil {
+		*ref = CategoryRef(strconv.Itoa(id))
+		return nil
+	}
+	var path string
+	if err := json.Unmarshal(data, &path); err != nil {
+		return fmt.Errorf("category must be an ID or a path: %s", data)
+	}
+	*ref = CategoryRef(path)
+	return nil
+}
+
+// CategoryTree is the full category list with paths resolved.
+type CategoryTree struct {
+	FetchedAt  time.Time  `json:"fetched_at"`
+	Categories []Category `json:"categories"`
+}
+
+func newCategoryTree(categories []Category) *CategoryTree {
+	byId := make(map[int]*Category, len(categories))
+	for i := range categories {
+		byId[categories[i].Id] = &categories[i]
+	}
+	for i := range categories {
+		var names []string
+		seen := map[int]bool{}
+		for category := &categories[i]; category != nil && !seen[category.Id]; category = byId[category.ParentId] {
+			seen[category.Id] = true
+			names = append([]string{category.Name}, names...)
+		}
+		categories[i].Path = strings.Join(names, "/")
+	}
+	sort.Slice(categories, func(i, j int) bool {
+		return categories[i].Path < categories[j].Path
+	})
+	return &CategoryTree{FetchedAt: time.Now(), Categories: categories}
+}
+
+var unsafeFileName = regexp.MustCompile(`[^A-Za-z0-9.-]+`)
+
+// categoryCachePath is where the category tree of client's server and API
+// version is cached, in the user's cache directory. Each server and version
+// has its own file, so a tree fetched from a mock or staging server is
+// never used against production.
+func categoryCachePath(client *Client) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	server := client.Server
+	if parsed, err := url.Parse(server); err == nil && parsed.Host != "" {
+		server = parsed.Host
+	}
+	name := fmt.Sprintf("categories-%s-v%d.json", unsafeFileName.ReplaceAllString(server, "_"), client.APIVersion)
+	return filepath.Join(dir, "ts-publishing-api-go", name), nil
+}
+
+// LoadCategoryTree returns the cached category tree, fetching it from the API
+// when the cache is missing, stale or refresh is set.
+func LoadCategoryTree(ctx context.Context, client *Client, refresh bool) (*CategoryTree, error) {
+	cachePath, err := categoryCachePath(client)
+	if err != nil {
+		logger.Debug("Categories will not be cached", "error", err)
+	}
+	if !refresh && cachePath != "" {
+		if data, err := ioutil.ReadFile(cachePath); err == nil {
+			var tree CategoryTree
+			if err = json.Unmarshal(data, &tree); err == nil && time.Since(tree.FetchedAt) < categoryCacheTTL {
+				return &tree, nil
+			}
+		}
+	}
+
+	logger.Debug("Fetching category tree")
+	records, err := client.RequestMany(ctx, "GET", "/api/categories", &Category{})
+	if err != nil {
+		return nil, fmt.Errorf("fetching categories: %s", err)
+	}
+	categories := make([]Category, 0, len(records))
+	for _, record := range records {
+		categories = append(categories, *record.(*Category))
+	}
+	tree := newCategoryTree(categories)
+	if cachePath == "" {
+		return tree, nil
+	}
+
+	data, err := json.MarshalIndent(tree, "", "  ")
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(cachePath), 0755)
+	}
+	if err == nil {
+		err = ioutil.WriteFile(cachePath, data, 0644)
+	}
+	if err != nil {
+		logger.Warn("Unable to cache categories", "file", cachePath, "error", err)
+	}
+	return tree, nil
+}
+
+// Resolve maps category references to IDs. Every reference that is not in
+// the tree is reported in the returned error.
+func (tree *CategoryTree) Resolve(refs []CategoryRef) ([]int, error) {
+	byId := map[int]bool{}
+	byPath := map[string]int{}
+	for _, category := range tree.Categories {
+		byId[category.Id] = true
+		byPath[strings.ToLower(category.Path)] = category.Id
+	}
+
+	var ids []int
+	var unknown []string
+	for _, ref := range refs {
+		if id, err := strconv.Atoi(string(ref)); err == nil {
+			if !byId[id] {
+				unknown = append(unknown, string(ref))
+				continue
+			}
+			ids = append(ids, id)
+			continue
+		}
+		path := strings.ToLower(strings.Trim(string(ref), "/ "))
+		id, ok := byPath[path]
+		if !ok {
+			unknown = append(unknown, string(ref))
+			continue
+		}
+		ids = append(ids, id)
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("unknown categories: %s (use `categories search <term>` to find valid ones)", strings.Join(unknown, ", "))
+	}
+	return ids, nil
+}
+
+// Search returns the categories whose path contains term, ignoring case.
+func (tree *CategoryTree) Search(term string) []Category {
+	term = strings.ToLower(term)
+	var matches []Category
+	for _, category := range tree.Categories {
+		if strings.Contains(strings.ToLower(category.Path), term) {
+			matches = append(matches, category)
+		}
+	}
+	return matches
+}
+
+func runCategories(command *Command, args []string) error {
+	flags := newCommandFlags(command)
+	refresh := flags.Bool("refresh", false, "Fetch the category tree even when the cache is fresh.")
+	flags.Parse(args)
+	if flags.NArg() < 2 || flags.Arg(0) != "search" {
+		flags.Usage()
+		return errUsage
+	}
+
+	client := NewClient(GetSettings())
+	tree, err := LoadCategoryTree(context.Background(), client, *refresh)
+	if err != nil {
+		return err
+	}
+	matches := tree.Search(strings.Join(flags.Args()[1:], " "))
+	if len(matches) == 0 {
+		fmt.Println("No matching categories")
+		return nil
+	}
+	for _, category := range matches {
+		fmt.Printf("%d\t%s\n", category.Id, category.Path)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCategoryCachePath(t *testing.T) {
+	tests := []struct {
+		server     string
+		apiVersion int
+		name       string
+	}{
+		{"https://api.turbosquid.com", 1, "categories-api.turbosquid.com-v1.json"},
+		{"https://api.turbosquid.com/", 2, "categories-api.turbosquid.com-v2.json"},
+		{"http://127.0.0.1:8080", 1, "categories-127.0.0.1_8080-v1.json"},
+		{"staging", 1, "categories-staging-v1.json"},
+	}
+	for _, test := range tests {
+		path, err := categoryCachePath(&Client{Server: test.server, APIVersion: test.apiVersion})
+		if err != nil {
+			t.Skipf("no user cache directory: %s", err)
+		}
+		if filepath.Base(path) != test.name || filepath.Base(filepath.Dir(path)) != "ts-publishing-api-go" {
+			t.Errorf("categoryCachePath(%s, %d) = %s, want .../ts-publishing-api-go/%s", test.server, test.apiVersion, path, test.name)
+		}
+	}
+}
+
+func TestResolveCategories(t *testing.T) {
+	tree := newCategoryTree([]Category{
+		{Id: 1, Name: "Furnishings"},
+		{Id: 2, Name: "Chair", ParentId: 1},
+		{Id: 3, Name: "Office Chair", ParentId: 2},
+	})
+	tests := []struct {
+		refs []CategoryRef
+		ids  []int
+		err  bool
+	}{
+		{refs: []CategoryRef{"Furnishings/Chair/Office Chair", "1"}, ids: []int{3, 1}},
+		{refs: []CategoryRef{" /furnishings/chair/ "}, ids: []int{2}},
+		{refs: []CategoryRef{"Furnishings/Table"}, err: true},
+		{refs: []CategoryRef{"99"}, err: true},
+	}
+	for _, test := range tests {
+		ids, err := tree.Resolve(test.refs)
+		if (err != nil) != test.err {
+			t.Errorf("Resolve(%q) error = %v, want error %v", test.refs, err, test.err)
+		} else if !test.err && !reflect.DeepEqual(ids, test.ids) {
+			t.Errorf("Resolve(%q) = %v, want %v", test.refs, ids, test.ids)
+		}
+	}
+}
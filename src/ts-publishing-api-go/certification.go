@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// CertificationRequirements are checks run on a product before it asks for
+// a certification tier. They catch a missing file or preview early; whether
+// the product is certified is decided by TurboSquid's inspection.
+type CertificationRequirements struct {
+	// Formats lists exchange formats of which at least one must be supplied.
+	Formats       []string `yaml:"formats"`
+	Native        bool     `yaml:"native"`
+	MinThumbnails int      `yaml:"min_thumbnails"`
+	MinWireframes int      `yaml:"min_wireframes"`
+	// ThumbnailWidth and ThumbnailHeight are a minimum above the one every
+	// thumbnail must meet; zero leaves it to the thumbnail rules.
+	ThumbnailWidth  int  `yaml:"thumbnail_width"`
+	ThumbnailHeight int  `yaml:"thumbnail_height"`
+	Turntable       bool `yaml:"turntable"`
+	Polygons        bool `yaml:"polygons"`
+	UVs             bool `yaml:"uvs"`
+}
+
+// certificationRequirements only checks what a CheckMate submission cannot
+// do without: a product file in a common exchange format alongside the
+// native one, a thumbnail and a polygon count, with UVs added for Pro.
+// TurboSquid does not publish its inspection as numbers this tool could
+// check, so there are no preview counts or sizes beyond that;
+// certification_checks in settings.yml adds them.
+var certificationRequirements = map[string]CertificationRequirements{
+	"turbosquid_checkmate_lite": {
+		Formats:       []string{"fbx", "obj"},
+		Native:        true,
+		MinThumbnails: 1,
+		Polygons:      true,
+	},
+	"turbosquid_checkmate_pro": {
+		Formats:       []string{"fbx", "obj"},
+		Native:        true,
+		MinThumbnails: 1,
+		Polygons:      true,
+		UVs:           true,
+	},
+}
+
+// certificationRequirementsFor returns certificationRequirements with the
+// tiers given in settings replaced.
+func certificationRequirementsFor(settings Settings) map[string]CertificationRequirements {
+	requirements := map[string]CertificationRequirements{}
+	for certification, tier := range certificationRequirements {
+		requirements[certification] = tier
+	}
+	for certification, tier := range settings.CertificationChecks {
+		requirements[certification] = tier
+	}
+	return requirements
+}
+
+// Problems lists every requirement the product does not meet. Thumbnails
+// are measured from the files that will be uploaded; wireframes are counted
+// separately and are not held to the thumbnail size.
+func (requirements CertificationRequirements) Problems(productBundle *ProductBundle) []string {
+	var problems []string
+	var formats []string
+	native := false
+	for _, file := range productBundle.Files {
+		if file.Type != "product_file" {
+			continue
+		}
+		formats = append(formats, strings.ToLower(file.Format))
+		native = native || file.Native
+	}
+	if len(requirements.Formats) > 0 {
+		found := false
+		for _, format := range requirements.Formats {
+			found = found || containsString(formats, format)
+		}
+		if !found {
+			problems = append(problems, fmt.Sprintf("needs a product file in one of %s", strings.Join(requirements.Formats, ", ")))
+		}
+	}
+	if requirements.Native && !native {
+		problems = append(problems, "needs a product file marked is_native")
+	}
+
+	thumbnails, wireframes, turntable := 0, 0, false
+	for i := range productBundle.Previews {
+		preview := &productBundle.Previews[i]
+		switch preview.Type {
+		case "wireframe":
+			wireframes++
+		case "thumbnail":
+			thumbnails++
+			info, err := inspectImage(previewPath(productBundle.Directory, preview))
+			if err != nil {
+				problems = append(problems, err.Error())
+			} else if info.Width < requirements.ThumbnailWidth || info.Height < requirements.ThumbnailHeight {
+				problems = append(problems, fmt.Sprintf("thumbnail %s is %dx%d, needs at least %dx%d",
+					filepath.Base(preview.Name), info.Width, info.Height, requirements.ThumbnailWidth, requirements.ThumbnailHeight))
+			}
+		case "turntable":
+			turntable = true
+		}
+	}
+	if thumbnails < requirements.MinThumbnails {
+		problems = append(problems, fmt.Sprintf("has %d thumbnails, needs at least %d", thumbnails, requirements.MinThumbnails))
+	}
+	if wireframes < requirements.MinWireframes {
+		problems = append(problems, fmt.Sprintf("has %d wireframes, needs at least %d", wireframes, requirements.MinWireframes))
+	}
+	if requirements.Turntable && !turntable {
+		problems = append(problems, "needs a turntable")
+	}
+	if requirements.Polygons && productBundle.Draft.Polygons == 0 {
+		problems = append(problems, "needs a polygon count")
+	}
+	if requirements.UVs && !boolValue(productBundle.Draft.UVMapped) && productBundle.Draft.UnwrappedUVs == "" {
+		problems = append(problems, "needs uv_mapped or unwrapped_u_vs")
+	}
+	return problems
+}
+
+// checkCertifications checks the product against every certification it
+// asks for, so failures are found before any certification is requested.
+// Tiers without known requirements are left to TurboSquid.
+func checkCertifications(productBundle *ProductBundle, tiers map[string]CertificationRequirements) error {
+	var problems []string
+	for _, certification := range productBundle.Certifications {
+		requirements, ok := tiers[certification]
+		if !ok {
+			logger.Debug("No local checks for certification", "certification", certification)
+			continue
+		}
+		for _, problem := range requirements.Problems(productBundle) {
+			problems = append(problems, fmt.Sprintf("%s: %s", certification, problem))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("product does not meet its certification requirements:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCertificationProblems(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ts-publishing-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	images := map[string][]byte{
+		"small.png": testPNG(t, 800, 600),
+		"large.png": testPNG(t, 1920, 1080),
+	}
+	for name, data := range images {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	yes := true
+	complete := func() *ProductBundle {
+		return &ProductBundle{
+			Directory: dir,
+			Draft:     Draft{Polygons: 12, UVMapped: &yes},
+			Files: []File{
+				{Name: "chair.max", Type: "product_file", Format: "3ds max", Native: true},
+				{Name: "chair.fbx", Type: "product_file", Format: "FBX"},
+			},
+			Previews: []Preview{{Name: "small.png", Type: "thumbnail"}},
+		}
+	}
+	lite := certificationRequirements["turbosquid_checkmate_lite"]
+	pro := certificationRequirements["turbosquid_checkmate_pro"]
+	strict := CertificationRequirements{MinThumbnails: 2, MinWireframes: 1, ThumbnailWidth: 1920, ThumbnailHeight: 1080, Turntable: true}
+
+	tests := []struct {
+		name         string
+		requirements CertificationRequirements
+		change       func(*ProductBundle)
+		problems     []string
+	}{
+		{name: "complete lite", requirements: lite},
+		{name: "complete pro", requirements: pro},
+		{
+			name:         "no exchange format",
+			requirements: lite,
+			change:       func(p *ProductBundle) { p.Files = p.Files[:1] },
+			problems:     []string{"needs a product file in one of fbx, obj"},
+		},
+		{
+			name:         "no native file",
+			requirements: lite,
+			change:       func(p *ProductBundle) { p.Files[0].Native = false },
+			problems:     []string{"needs a product file marked is_native"},
+		},
+		{
+			name:         "wireframes are not thumbnails",
+			requirements: lite,
+			change:       func(p *ProductBundle) { p.Previews[0].Type = "wireframe" },
+			problems:     []string{"has 0 thumbnails, needs at least 1"},
+		},
+		{
+			name:         "no polygon count",
+			requirements: lite,
+			change:       func(p *ProductBundle) { p.Draft.Polygons = 0 },
+			problems:     []string{"needs a polygon count"},
+		},
+		{
+			name:         "no uvs for pro",
+			requirements: pro,
+			change:       func(p *ProductBundle) { p.Draft.UVMapped = nil },
+			problems:     []string{"needs uv_mapped or unwrapped_u_vs"},
+		},
+		{
+			name:         "unwrapped uvs count for pro",
+			requirements: pro,
+			change:       func(p *ProductBundle) { p.Draft.UVMapped, p.Draft.UnwrappedUVs = nil, "non_overlapping" },
+		},
+		{
+			name:         "configured counts and sizes",
+			requirements: strict,
+			problems: []string{
+				"thumbnail small.png is 800x600, needs at least 1920x1080",
+				"has 1 thumbnails, needs at least 2",
+				"has 0 wireframes, needs at least 1",
+				"needs a turntable",
+			},
+		},
+		{
+			name:         "configured counts and sizes met",
+			requirements: strict,
+			change: func(p *ProductBundle) {
+				p.Previews = []Preview{
+					{Name: "large.png", Type: "thumbnail"},
+					{Name: "large.png", Type: "thumbnail"},
+					{Name: "small.png", Type: "wireframe"},
+					{Name: "spin", Type: "turntable"},
+				}
+			},
+		},
+	}
+	for _, test := range tests {
+		productBundle := complete()
+		if test.change != nil {
+			test.change(productBundle)
+		}
+		if problems := test.requirements.Problems(productBundle); !reflect.DeepEqual(problems, test.problems) {
+			t.Errorf("%s: Problems = %q, want %q", test.name, problems, test.problems)
+		}
+	}
+}
+
+func TestCertificationRequirementsFor(t *testing.T) {
+	custom := CertificationRequirements{MinThumbnails: 5}
+	requirements := certificationRequirementsFor(Settings{CertificationChecks: map[string]CertificationRequirements{
+		"turbosquid_checkmate_pro": custom,
+	}})
+	if !reflect.DeepEqual(requirements["turbosquid_checkmate_pro"], custom) {
+		t.Errorf("pro requirements are %+v, want %+v", requirements["turbosquid_checkmate_pro"], custom)
+	}
+	if !reflect.DeepEqual(requirements["turbosquid_checkmate_lite"], certificationRequirements["turbosquid_checkmate_lite"]) {
+		t.Errorf("lite requirements changed to %+v", requirements["turbosquid_checkmate_lite"])
+	}
+	if certificationRequirements["turbosquid_checkmate_pro"].MinThumbnails != 1 {
+		t.Errorf("certificationRequirementsFor changed the defaults")
+	}
+}
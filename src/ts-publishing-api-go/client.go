@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/google/jsonapi"
+)
+
+// MediaType is the JSON:API media type used for request and response bodies.
+const MediaType = "application/vnd.api+json"
+
+// RequestHook is called with every request after its headers are set and
+// before it is sent. Returning an error aborts the request.
+type RequestHook func(req *http.Request) error
+
+// Client performs JSON:API requests against the TurboSquid publishing API.
+type Client struct {
+	Server     string
+	Token      string
+	APIVersion int
+	HTTPClient *http.Client
+	Hooks      []RequestHook
+}
+
+// APIError is returned when the API answers with a non-2xx status.
+type APIError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("%s %s: %s", e.Method, e.URL, e.Status)
+	}
+	return fmt.Sprintf("%s %s: %s: %s", e.Method, e.URL, e.Status, e.Body)
+}
+
+func NewClient(settings Settings) *Client {
+	return &Client{
+		Server:     settings.Server,
+		Token:      settings.Token,
+		APIVersion: settings.APIVersion,
+		HTTPClient: &http.Client{},
+	}
+}
+
+// AddHook registers a hook that runs for every subsequent request.
+func (client *Client) AddHook(hook RequestHook) {
+	client.Hooks = append(client.Hooks, hook)
+}
+
+// Accept returns the Accept header value for the configured API version.
+func (client *Client) Accept() string {
+	return fmt.Sprintf("%s; com.turbosquid.api.version=%d", MediaType, client.APIVersion)
+}
+
+// NewRequest builds an authenticated request for path bound to ctx. When
+// payload is not nil it is marshalled as a JSON:API document and sent as the
+// request body.
+func (client *Client) NewRequest(ctx context.Context, method string, path string, payload interface{}) (*http.Request, error) {
+	var body io.Reader
+	if payload != nil {
+		var message bytes.Buffer
+		if err := jsonapi.MarshalPayloadWithoutIncluded(&message, payload); err != nil {
+			return nil, fmt.Errorf("building %s %s message: %s", method, path, err)
+		}
+		body = bytes.NewReader(message.Bytes())
+	}
+
+	url := fmt.Sprintf("%s%s", strings.TrimRight(client.Server, "/"), path)
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Authorization", fmt.Sprintf("Token %s", client.Token))
+	req.Header.Set("Accept", client.Accept())
+	if payload != nil {
+		req.Header.Set("Content-Type", MediaType)
+	}
+	return req, nil
+}
+
+// Do sends req and, when out is not nil, unmarshals the JSON:API response
+// document into it. Responses outside the 2xx range are returned as *APIError.
+func (client *Client) Do(req *http.Request, out interface{}) error {
+	body, err := client.send(req)
+	if err != nil || out == nil || len(body) == 0 {
+		return err
+	}
+	return jsonapi.UnmarshalPayload(bytes.NewReader(body), out)
+}
+
+// Request builds and sends a request in one step.
+func (client *Client) Request(ctx context.Context, method string, path string, payload interface{}, out interface{}) error {
+	req, err := client.NewRequest(ctx, method, path, payload)
+	if err != nil {
+		return err
+	}
+	return client.Do(req, out)
+}
+
+// RequestMany sends a request whose response holds a collection of records
+// of the same type as model, which must be a pointer to a struct.
+func (client *Client) RequestMany(ctx context.Context, method string, path string, model interface{}) ([]interface{}, error) {
+	req, err := client.NewRequest(ctx, method, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	body, err := client.send(req)
+	if err != nil {
+		return nil, err
+	}
+	return jsonapi.UnmarshalManyPayload(bytes.NewReader(body), reflect.TypeOf(model))
+}
+
+// Resource is a JSON:API resource whose attributes are left for the caller
+// to decode, for records that do not map onto one of the jsonapi models.
+type Resource struct {
+	Type          string                     `json:"type"`
+	Id            string                     `json:"id"`
+	Attributes    json.RawMessage            `json:"attributes"`
+	Relationships map[string]json.RawMessage `json:"relationships"`
+}
+
+// Relationship returns the ID of a to-one relationship, or "" when it is not
+// set.
+func (resource Resource) Relationship(name string) string {
+	var relationship struct {
+		Data *struct {
+			Id string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(resource.Relationships[name], &relationship); err != nil || relationship.Data == nil {
+		return ""
+	}
+	return relationship.Data.Id
+}
+
+// RequestResources sends a request and returns the resources in the response,
+// whether it holds one resource or a collection.
+func (client *Client) RequestResources(ctx context.Context, method string, path string) ([]Resource, error) {
+	page, err := client.RequestPage(ctx, method, path)
+	return page.Resources, err
+}
+
+// ResourcePage is one page of a JSON:API collection.
+type ResourcePage struct {
+	Resources []Resource
+	// Next is the path of the following page, or "" on the last page.
+	Next string
+	// Linked is set when the response had pagination links, so an empty
+	// Next means there are no more pages.
+	Linked bool
+}
+
+// RequestPage is RequestResources for paginated collections. It also reads
+// the JSON:API links.next of the response.
+func (client *Client) RequestPage(ctx context.Context, method string, path string) (ResourcePage, error) {
+	var page ResourcePage
+	req, err := client.NewRequest(ctx, method, path, nil)
+	if err != nil {
+		return page, err
+	}
+	body, err := client.send(req)
+	if err != nil {
+		return page, err
+	}
+	var document struct {
+		Data  json.RawMessage `json:"data"`
+		Links *struct {
+			Next string `json:"next"`
+		} `json:"links"`
+	}
+	if err = json.Unmarshal(body, &document); err != nil {
+		return page, fmt.Errorf("invalid JSON:API document: %s", err)
+	}
+	if document.Links != nil {
+		page.Linked = true
+		// Links may be absolute; requests are always sent to the server.
+		if next, err := url.Parse(document.Links.Next); err == nil && document.Links.Next != "" {
+			page.Next = next.RequestURI()
+		}
+	}
+	data := bytes.TrimSpace(document.Data)
+	if len(data) == 0 || bytes.Equal(data, []byte("null")) {
+		return page, nil
+	}
+	if data[0] != '[' {
+		data = append(append([]byte("["), data...), ']')
+	}
+	if err = json.Unmarshal(data, &page.Resources); err != nil {
+		return page, fmt.Errorf("invalid JSON:API resource: %s", err)
+	}
+	return page, nil
+}
+
+func (client *Client) send(req *http.Request) ([]byte, error) {
+	for _, hook := range client.Hooks {
+		if err := hook(req); err != nil {
+			return nil, err
+		}
+	}
+
+	if logger.Enabled(LevelTrace) {
+		logger.Trace("API request", "method", req.Method, "url", req.URL.String(),
+			"headers", RedactHeaders(req.Header), "body", requestBody(req))
+	}
+
+	start := time.Now()
+	resp, err := client.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Debug("API response", "method", req.Method, "url", req.URL.String(),
+		"status", resp.StatusCode, "duration", time.Since(start))
+	if logger.Enabled(LevelTrace) {
+		logger.Trace("API response body", "method", req.Method, "url", req.URL.String(),
+			"headers", RedactHeaders(resp.Header), "body", json.RawMessage(RedactJSON(body)))
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, &APIError{
+			Method:     req.Method,
+			URL:        req.URL.String(),
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			Body:       strings.TrimSpace(string(body)),
+		}
+	}
+	return body, nil
+}
+
+// requestBody returns the redacted body of req without consuming it.
+func requestBody(req *http.Request) json.RawMessage {
+	if req.GetBody == nil {
+		return nil
+	}
+	reader, err := req.GetBody()
+	if err != nil {
+		return nil
+	}
+	defer reader.Close()
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil
+	}
+	return json.RawMessage(RedactJSON(body))
+}
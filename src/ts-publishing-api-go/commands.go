@@ -0,0 +1,137 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// Command is a subcommand run as `ts-publishing-api-go <name> [flags]`.
+// Running without a subcommand publishes a product folder.
+type Command struct {
+	Name        string
+	Usage       string
+	Description string
+	Run         func(command *Command, args []string) error
+	// ErrorStatus is the exit status when the command fails, 1 when not
+	// set.
+	ErrorStatus int
+}
+
+var commands = []Command{
+	{
+		Name:        "mock-server",
+		Usage:       "mock-server [-addr :8080] [-token TOKEN] [-fail 'POST /api/drafts=500'] [-delay '/api/uploads/*=2s']",
+		Description: "Run a local fake of the TurboSquid publishing API and its S3 bucket.",
+		Run:         runMockServer,
+	},
+	{
+		Name:        "categories",
+		Usage:       "categories [-refresh] search <term>",
+		Description: "Search the TurboSquid category tree for IDs and paths to use in product.json.",
+		Run:         runCategories,
+	},
+	{
+		Name:        "render",
+		Usage:       "render [-var key=value] <product folder or product.json>",
+		Description: "Print a product after templates are merged and files are expanded.",
+		Run:         runRender,
+	},
+	{
+		Name:        "description",
+		Usage:       "description [-var key=value] <product folder or product.json>",
+		Description: "Print a product's final description after templates, conversion and linting.",
+		Run:         runDescription,
+	},
+	{
+		Name:        "drafts",
+		Usage:       "drafts [-page N] [-size N] list | drafts [-bundle] show <id> | drafts delete <id>... | drafts prune -older-than DAYS [-yes]",
+		Description: "List, show or delete the account's drafts, or delete drafts older than a number of days.",
+		Run:         runRecords,
+	},
+	{
+		Name:        "products",
+		Usage:       "products [-page N] [-size N] list | products [-bundle] show <id> | products (unpublish | relist) <id>...",
+		Description: "List or show the account's products, or take them offline and list them again.",
+		Run:         runRecords,
+	},
+	{
+		Name:        "export",
+		Usage:       "export [-dir DIR] [-no-download] [-force] <product id>",
+		Description: "Write a published product as a product folder with product.json and its files.",
+		Run:         runExport,
+	},
+	{
+		Name:        "diff",
+		Usage:       "diff (-draft ID | -product ID) [-json] [-var key=value] <product folder or product.json>",
+		Description: "Show how a local product differs from a live draft or product.",
+		Run:         runDiff,
+		// Like diff(1): 1 means differences were found, 2 means trouble.
+		ErrorStatus: 2,
+	},
+}
+
+// exitStatus is returned by a command that has already reported why it
+// stopped, so runCommand only exits with the status.
+type exitStatus int
+
+func (status exitStatus) Error() string {
+	return fmt.Sprintf("exit status %d", int(status))
+}
+
+// errUsage is returned after a command prints its usage for invalid
+// arguments.
+const errUsage = exitStatus(2)
+
+func findCommand(name string) *Command {
+	for i := range commands {
+		if commands[i].Name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+// newCommandFlags returns a flag set whose usage text describes command.
+func newCommandFlags(command *Command) *flag.FlagSet {
+	flags := flag.NewFlagSet(command.Name, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "\n%s\n\nUsage:\n\t%s\n\nArguments:\n", command.Description, command.Usage)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+func printCommands() {
+	fmt.Fprintf(flag.CommandLine.Output(), "\nCommands:\n")
+	for _, command := range commands {
+		fmt.Fprintf(flag.CommandLine.Output(), "\t%-14s %s\n", command.Name, command.Description)
+	}
+}
+
+// runCommand runs the subcommand named by the first argument, if any, and
+// reports whether one was found.
+func runCommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	command := findCommand(args[0])
+	if command == nil {
+		return false
+	}
+	status := 1
+	if command.ErrorStatus != 0 {
+		status = command.ErrorStatus
+		// Fatal errors, such as an unreadable product, fail the command too.
+		logger.exitFn = func(int) { os.Exit(status) }
+	}
+	err := command.Run(command, args[1:])
+	if status, ok := err.(exitStatus); ok {
+		os.Exit(int(status))
+	}
+	if err != nil {
+		logger.Error(fmt.Sprintf("%s failed", command.Name), "error", err)
+		os.Exit(status)
+	}
+	return true
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// maxDescriptionLength is the longest description TurboSquid accepts,
+// counted after conversion to HTML.
+const maxDescriptionLength = 10000
+
+// competitorNames are other marketplaces a listing may not mention.
+var competitorNames = []string{
+	"cgtrader", "sketchfab", "3dexport", "free3d", "cubebrush", "renderhub",
+	"artstation marketplace", "unity asset store", "unreal marketplace", "fab.com",
+}
+
+var (
+	urlPattern   = regexp.MustCompile(`(?i)\b(?:https?://|www\.)[^\s<>()]+`)
+	emailPattern = regexp.MustCompile(`(?i)\b[a-z0-9._%+-]+@[a-z0-9.-]+\.[a-z]{2,}\b`)
+)
+
+// lintDescription lists content TurboSquid does not allow in descriptions.
+func lintDescription(text string) []string {
+	var problems []string
+	for _, url := range urlPattern.FindAllString(text, -1) {
+		problems = append(problems, fmt.Sprintf("external URL %s", url))
+	}
+	for _, email := range emailPattern.FindAllString(text, -1) {
+		problems = append(problems, fmt.Sprintf("email address %s", email))
+	}
+	lower := strings.ToLower(text)
+	for _, name := range competitorNames {
+		if strings.Contains(lower, name) {
+			problems = append(problems, fmt.Sprintf("competitor name %q", name))
+		}
+	}
+	return problems
+}
+
+var (
+	markdownBold   = regexp.MustCompile(`\*\*(.+?)\*\*|__(.+?)__`)
+	markdownItalic = regexp.MustCompile(`\*(.+?)\*|\b_(.+?)_\b`)
+	markdownLink   = regexp.MustCompile(`\[([^\]]+)\]\([^)]*\)`)
+	markdownBullet = regexp.MustCompile(`^[-*+]\s+`)
+	markdownNumber = regexp.MustCompile(`^\d+[.)]\s+`)
+	markdownHeader = regexp.MustCompile(`^#{1,6}\s+`)
+)
+
+// markdownToHTML converts the Markdown subset descriptions use into the
+// tags TurboSquid accepts: paragraphs, line breaks, bold, italic and lists.
+// Headings become bold paragraphs and links keep only their text.
+func markdownToHTML(markdown string) string {
+	var out []string
+	var paragraph []string
+	list := ""
+
+	flushParagraph := func() {
+		if len(paragraph) > 0 {
+			out = append(out, "<p>"+strings.Join(paragraph, "<br>")+"</p>")
+			paragraph = nil
+		}
+	}
+	closeList := func() {
+		if list != "" {
+			out = append(out, "</"+list+">")
+			list = ""
+		}
+	}
+	openList := func(tag string) {
+		if list != tag {
+			closeList()
+			out = append(out, "<"+tag+">")
+			list = tag
+		}
+	}
+
+	for _, line := range strings.Split(strings.Replace(markdown, "\r\n", "\n", -1), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+			flushParagraph()
+			closeList()
+		case markdownHeader.MatchString(line):
+			flushParagraph()
+			closeList()
+			out = append(out, "<p><strong>"+inlineMarkdown(markdownHeader.ReplaceAllString(line, ""))+"</strong></p>")
+		case markdownBullet.MatchString(line):
+			flushParagraph()
+			openList("ul")
+			out = append(out, "<li>"+inlineMarkdown(markdownBullet.ReplaceAllString(line, ""))+"</li>")
+		case markdownNumber.MatchString(line):
+			flushParagraph()
+			openList("ol")
+			out = append(out, "<li>"+inlineMarkdown(markdownNumber.ReplaceAllString(line, ""))+"</li>")
+		default:
+			closeList()
+			paragraph = append(paragraph, inlineMarkdown(line))
+		}
+	}
+	flushParagraph()
+	closeList()
+	return strings.Join(out, "\n")
+}
+
+func inlineMarkdown(text string) string {
+	text = markdownLink.ReplaceAllString(text, "$1")
+	text = html.EscapeString(text)
+	text = markdownBold.ReplaceAllString(text, "<strong>$1$2</strong>")
+	return markdownItalic.ReplaceAllString(text, "<em>$1$2</em>")
+}
+
+// loadDescriptionFile reads the draft's description_file, relative to the
+// product folder, into Description so templates can expand it.
+func (productBundle *ProductBundle) loadDescriptionFile() error {
+	draft := &productBundle.Draft
+	if draft.DescriptionFile == "" {
+		return nil
+	}
+	if draft.Description != "" {
+		return fmt.Errorf("description and description_file cannot both be set")
+	}
+	markdown, err := ioutil.ReadFile(filepath.Join(productBundle.Directory, draft.DescriptionFile))
+	if err != nil {
+		return err
+	}
+	draft.Description = string(markdown)
+	return nil
+}
+
+// prepareDescription converts the description from Markdown when it came
+// from a description_file. The text as written is kept for linting, since
+// conversion drops link targets.
+func (productBundle *ProductBundle) prepareDescription() {
+	draft := &productBundle.Draft
+	draft.descriptionSource = draft.Description
+	if draft.DescriptionFile != "" {
+		draft.Description = markdownToHTML(draft.Description)
+	}
+}
+
+// checkDescription lints the description and checks its length. All
+// problems are reported together.
+func (draft *Draft) checkDescription() error {
+	source := draft.descriptionSource
+	if source == "" {
+		source = draft.Description
+	}
+	problems := lintDescription(source)
+	if length := len([]rune(draft.Description)); length > maxDescriptionLength {
+		problems = append(problems, fmt.Sprintf("%d characters, at most %d are allowed", length, maxDescriptionLength))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("description is not valid:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+func runDescription(command *Command, args []string) error {
+	flags := newCommandFlags(command)
+	vars := varFlags{}
+	flags.Var(vars, "var", "Set a template variable as key=value. May be repeated.")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	productBundle := ReadInput(flags.Arg(0), vars)
+	fmt.Println(productBundle.Draft.Description)
+	return productBundle.Draft.checkDescription()
+}
@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestMarkdownToHTML(t *testing.T) {
+	tests := []struct {
+		markdown string
+		html     string
+	}{
+		{"Hello\nworld", "<p>Hello<br>world</p>"},
+		{"one\r\n\r\ntwo", "<p>one</p>\n<p>two</p>"},
+		{"# Specs", "<p><strong>Specs</strong></p>"},
+		{"- a\n* b", "<ul>\n<li>a</li>\n<li>b</li>\n</ul>"},
+		{"1. a\n2) b", "<ol>\n<li>a</li>\n<li>b</li>\n</ol>"},
+		{"- a\n1. b", "<ul>\n<li>a</li>\n</ul>\n<ol>\n<li>b</li>\n</ol>"},
+		{"Intro\n- a", "<p>Intro</p>\n<ul>\n<li>a</li>\n</ul>"},
+		{"**bold** and *italic*", "<p><strong>bold</strong> and <em>italic</em></p>"},
+		{"__bold__ and _italic_", "<p><strong>bold</strong> and <em>italic</em></p>"},
+		{"see [the docs](http://example.com)", "<p>see the docs</p>"},
+		{"a < b & c", "<p>a &lt; b &amp; c</p>"},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if html := markdownToHTML(test.markdown); html != test.html {
+			t.Errorf("markdownToHTML(%q) = %q, want %q", test.markdown, html, test.html)
+		}
+	}
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Change is one difference between the local product and the remote record.
+type Change struct {
+	Section string      `json:"section"`
+	Item    string      `json:"item"`
+	Change  string      `json:"change"`
+	Local   interface{} `json:"local,omitempty"`
+	Remote  interface{} `json:"remote,omitempty"`
+}
+
+// ProductDiff lists what publishing the local product would change.
+type ProductDiff struct {
+	Kind    string   `json:"kind"`
+	Id      int      `json:"id"`
+	Changes []Change `json:"changes"`
+}
+
+// diffAttributes compares the draft attributes a listing shows.
+func diffAttributes(local Draft, localCategories []int, remote *RemoteRecord) []Change {
+	var changes []Change
+	compare := func(item string, localValue interface{}, remoteValue interface{}) {
+		if !reflect.DeepEqual(localValue, remoteValue) {
+			changes = append(changes, Change{Section: "attribute", Item: item, Change: "changed", Local: localValue, Remote: remoteValue})
+		}
+	}
+	draft := remote.Draft
+	compare("name", local.Name, draft.Name)
+	localPrice, remotePrice := local.price(), draft.price()
+	compare("price", formatCents(localPrice.Value)+" "+localPrice.Currency, formatCents(remotePrice.Value)+" "+remotePrice.Currency)
+	compare("tags", append([]string{}, local.Tags...), append([]string{}, draft.Tags...))
+	compare("description", local.Description, draft.Description)
+	compare("license", local.License, draft.License)
+	compare("product_type", local.Type, draft.Type)
+	compare("geometry", local.Geometry, draft.Geometry)
+	compare("polygons", local.Polygons, draft.Polygons)
+	compare("vertices", local.Vertices, draft.Vertices)
+	compare("animated", boolValue(local.Animated), boolValue(draft.Animated))
+	compare("materials", boolValue(local.Materials), boolValue(draft.Materials))
+	compare("rigged", boolValue(local.Rigged), boolValue(draft.Rigged))
+	compare("textures", boolValue(local.Textures), boolValue(draft.Textures))
+	compare("uv_mapped", boolValue(local.UVMapped), boolValue(draft.UVMapped))
+	compare("unwrapped_u_vs", local.UnwrappedUVs, draft.UnwrappedUVs)
+	if localCategories != nil {
+		compare("categories", sortedInts(localCategories), sortedInts(remote.CategoryIds))
+	}
+	return changes
+}
+
+// boolValue treats a flag left out as false.
+func boolValue(value *bool) bool {
+	return value != nil && *value
+}
+
+func sortedInts(values []int) []int {
+	sorted := append([]int{}, values...)
+	sort.Ints(sorted)
+	return sorted
+}
+
+// fileHash returns the SHA-256 of a local file.
+func fileHash(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err = io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// remoteHash hashes a remote file by streaming its download URL.
+func remoteHash(ctx context.Context, client *Client, url string) (string, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.HTTPClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	hash := sha256.New()
+	if _, err = io.Copy(hash, resp.Body); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// diffFiles matches files by type and name, and compares the contents of
+// files present on both sides when the remote file can be downloaded.
+func diffFiles(ctx context.Context, client *Client, productBundle *ProductBundle, remote *RemoteRecord) ([]Change, error) {
+	var changes []Change
+	remoteFiles := map[string]File{}
+	for _, file := range remote.Files {
+		remoteFiles[file.Type+" "+file.Name] = file
+	}
+	seen := map[string]bool{}
+	for _, file := range productBundle.Files {
+		name := filepath.Base(file.Name)
+		if file.Archive != "" {
+			// Archived directories are uploaded as <directory>.zip.
+			name = filepath.Base(filepath.Clean(file.Name)) + ".zip"
+		}
+		key := file.Type + " " + name
+		seen[key] = true
+		remoteFile, ok := remoteFiles[key]
+		if !ok {
+			changes = append(changes, Change{Section: "file", Item: key, Change: "added"})
+			continue
+		}
+		if file.Type == "product_file" && (file.Format != remoteFile.Format || file.FormatVersion != remoteFile.FormatVersion) {
+			changes = append(changes, Change{Section: "file", Item: key, Change: "changed",
+				Local: strings.TrimSpace(file.Format + " " + file.FormatVersion), Remote: strings.TrimSpace(remoteFile.Format + " " + remoteFile.FormatVersion)})
+		}
+		url := remote.DownloadURLs[remoteFile.FileId]
+		if url == "" || file.Archive != "" {
+			continue
+		}
+		localHash, err := fileHash(filepath.Join(productBundle.Directory, file.Name))
+		if err != nil {
+			return nil, err
+		}
+		hash, err := remoteHash(ctx, client, url)
+		if err != nil {
+			return nil, fmt.Errorf("hashing remote %s: %s", file.Name, err)
+		}
+		if localHash != hash {
+			changes = append(changes, Change{Section: "file", Item: key, Change: "content changed", Local: localHash, Remote: hash})
+		}
+	}
+	for _, file := range remote.Files {
+		if key := file.Type + " " + file.Name; !seen[key] {
+			changes = append(changes, Change{Section: "file", Item: key, Change: "removed"})
+		}
+	}
+	return changes, nil
+}
+
+// diffPreviews matches previews by type and name, then pairs the remaining
+// previews of each type in order, since the API does not always return
+// preview names. Turntables also compare their frame counts.
+func diffPreviews(productBundle *ProductBundle, remote *RemoteRecord) []Change {
+	var changes []Change
+	matched := map[int]bool{}
+	var unmatched []Preview
+	for _, preview := range productBundle.Previews {
+		found := false
+		for i, remotePreview := range remote.Previews {
+			if !matched[i] && remotePreview.Type == preview.Type && remotePreview.Name == filepath.Base(preview.Name) {
+				matched[i], found = true, true
+				changes = append(changes, diffPreview(preview, remotePreview)...)
+				break
+			}
+		}
+		if !found {
+			unmatched = append(unmatched, preview)
+		}
+	}
+	for _, preview := range unmatched {
+		found := false
+		for i, remotePreview := range remote.Previews {
+			if !matched[i] && remotePreview.Type == preview.Type {
+				matched[i], found = true, true
+				changes = append(changes, diffPreview(preview, remotePreview)...)
+				break
+			}
+		}
+		if !found {
+			changes = append(changes, Change{Section: "preview", Item: preview.Type + " " + preview.Name, Change: "added"})
+		}
+	}
+	for i, preview := range remote.Previews {
+		if !matched[i] {
+			changes = append(changes, Change{Section: "preview", Item: preview.Type + " " + preview.Name, Change: "removed"})
+		}
+	}
+	return changes
+}
+
+func diffPreview(local Preview, remote Preview) []Change {
+	if local.Type == "turntable" && len(local.FramePaths) > 0 && len(local.FramePaths) != len(remote.FileIds) {
+		return []Change{{Section: "preview", Item: local.Type + " " + local.Name, Change: "frames changed", Local: len(local.FramePaths), Remote: len(remote.FileIds)}}
+	}
+	return nil
+}
+
+func diffCertifications(local []string, remote []string) []Change {
+	var changes []Change
+	for _, certification := range local {
+		if !containsString(remote, certification) {
+			changes = append(changes, Change{Section: "certification", Item: certification, Change: "added"})
+		}
+	}
+	for _, certification := range remote {
+		if !containsString(local, certification) {
+			changes = append(changes, Change{Section: "certification", Item: certification, Change: "removed"})
+		}
+	}
+	return changes
+}
+
+// print writes the diff as one line per change, marked + for added, - for
+// removed and ~ for changed.
+func (diff *ProductDiff) print() {
+	if len(diff.Changes) == 0 {
+		fmt.Printf("No differences from %s %d\n", diff.Kind, diff.Id)
+		return
+	}
+	for _, change := range diff.Changes {
+		marker := "~"
+		switch change.Change {
+		case "added":
+			marker = "+"
+		case "removed":
+			marker = "-"
+		}
+		line := fmt.Sprintf("%s %s %s", marker, change.Section, change.Item)
+		if change.Change != "added" && change.Change != "removed" {
+			line += ": " + change.Change
+		}
+		if change.Local != nil || change.Remote != nil {
+			line += fmt.Sprintf("\n    local:  %s\n    remote: %s", diffValue(change.Local), diffValue(change.Remote))
+		}
+		fmt.Println(line)
+	}
+}
+
+func diffValue(value interface{}) string {
+	if text, ok := value.(string); ok {
+		return strconv.Quote(text)
+	}
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+// errDifferences is returned when the diff was printed and found changes.
+// Like diff(1), the command then exits with 1, keeping 2 for errors.
+const errDifferences = exitStatus(1)
+
+func runDiff(command *Command, args []string) error {
+	flags := newCommandFlags(command)
+	draftId := flags.Int("draft", 0, "Compare against this draft.")
+	productId := flags.Int("product", 0, "Compare against this product.")
+	asJSON := flags.Bool("json", false, "Print the differences as JSON.")
+	vars := varFlags{}
+	flags.Var(vars, "var", "Set a template variable as key=value. May be repeated.")
+	flags.Parse(args)
+	if flags.NArg() != 1 || (*draftId == 0) == (*productId == 0) {
+		flags.Usage()
+		return errUsage
+	}
+	kind, id := "draft", *draftId
+	if *productId > 0 {
+		kind, id = "product", *productId
+	}
+
+	settings := GetSettings()
+	productBundle := ReadInput(flags.Arg(0), vars)
+	if err := prepareTags(&productBundle.Draft, settings.TagSynonyms); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	client := NewClient(settings)
+	var localCategories []int
+	if len(productBundle.Categories) > 0 {
+		tree, err := LoadCategoryTree(ctx, client, false)
+		if err != nil {
+			return fmt.Errorf("Error loading categories: %s", err)
+		}
+		if localCategories, err = tree.Resolve(productBundle.Categories); err != nil {
+			return err
+		}
+	}
+	for i := range productBundle.Previews {
+		preview := &productBundle.Previews[i]
+		if preview.Type == "turntable" && preview.SpriteSheet == nil {
+			frames, err := turntableFrames(productBundle.Directory, *preview, "")
+			if err != nil {
+				return fmt.Errorf("%s: %s", preview.Name, err)
+			}
+			preview.FramePaths = frames
+		}
+	}
+
+	remote, err := fetchRecord(ctx, client, kind, id)
+	if err != nil {
+		return err
+	}
+	diff := ProductDiff{Kind: kind, Id: id, Changes: []Change{}}
+	diff.Changes = append(diff.Changes, diffAttributes(productBundle.Draft, localCategories, remote)...)
+	files, err := diffFiles(ctx, client, &productBundle, remote)
+	if err != nil {
+		return err
+	}
+	diff.Changes = append(diff.Changes, files...)
+	diff.Changes = append(diff.Changes, diffPreviews(&productBundle, remote)...)
+	diff.Changes = append(diff.Changes, diffCertifications(productBundle.Certifications, remote.Certifications)...)
+
+	if *asJSON {
+		output, err := json.MarshalIndent(diff, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(output))
+	} else {
+		diff.print()
+	}
+	if len(diff.Changes) > 0 {
+		return errDifferences
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// matchGlob reports whether the slash-separated name matches pattern. Each
+// pattern segment is matched with path.Match, and a "**" segment matches any
+// number of directories, including none.
+func matchGlob(pattern string, name string) (bool, error) {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern []string, name []string) (bool, error) {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for skip := 0; skip <= len(name); skip++ {
+				matched, err := matchSegments(pattern[1:], name[skip:])
+				if matched || err != nil {
+					return matched, err
+				}
+			}
+			return false, nil
+		}
+		if len(name) == 0 {
+			return false, nil
+		}
+		matched, err := path.Match(pattern[0], name[0])
+		if !matched || err != nil {
+			return false, err
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0, nil
+}
+
+// globFiles returns the files below directory matching pattern, as sorted
+// slash-separated paths relative to directory. Hidden files and directories
+// are skipped unless the pattern names them explicitly.
+func globFiles(directory string, pattern string) ([]string, error) {
+	pattern = strings.TrimPrefix(filepath.ToSlash(pattern), "./")
+	if _, err := matchGlob(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %s", pattern, err)
+	}
+
+	var matches []string
+	err := filepath.Walk(directory, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(directory, file)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if strings.HasPrefix(info.Name(), ".") && !strings.Contains(pattern, "/.") && !strings.HasPrefix(pattern, ".") {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			return nil
+		}
+		matched, err := matchGlob(pattern, rel)
+		if matched {
+			matches = append(matches, rel)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// expandFilePatterns replaces every file entry that has a pattern with one
+// entry per matching file, each sharing the pattern entry's attributes.
+// Files already listed by name are not added twice.
+func (productBundle *ProductBundle) expandFilePatterns() error {
+	listed := map[string]bool{}
+	for _, file := range productBundle.Files {
+		if file.Pattern == "" {
+			listed[filepath.ToSlash(file.Name)] = true
+		}
+	}
+
+	var files []File
+	for _, file := range productBundle.Files {
+		if file.Pattern == "" {
+			files = append(files, file)
+			continue
+		}
+		matches, err := globFiles(productBundle.Directory, file.Pattern)
+		if err != nil {
+			return err
+		}
+		if len(matches) == 0 {
+			return fmt.Errorf("file pattern %q matched no files in %s", file.Pattern, productBundle.Directory)
+		}
+		for _, match := range matches {
+			if listed[match] {
+				logger.Debug("File already listed", "pattern", file.Pattern, "file", match)
+				continue
+			}
+			listed[match] = true
+			expanded := file
+			expanded.Pattern = ""
+			expanded.Name = match
+			files = append(files, expanded)
+		}
+		logger.Debug("Expanded file pattern", "pattern", file.Pattern, "matches", len(matches))
+	}
+	productBundle.Files = files
+	return nil
+}
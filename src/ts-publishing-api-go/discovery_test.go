@@ -0,0 +1,34 @@
+package main
+
+import "testing"
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		matched bool
+		err     bool
+	}{
+		{pattern: "*.png", name: "a.png", matched: true},
+		{pattern: "*.png", name: "dir/a.png"},
+		{pattern: "dir/*.png", name: "dir/a.png", matched: true},
+		{pattern: "**/*.png", name: "a.png", matched: true},
+		{pattern: "**/*.png", name: "x/y/a.png", matched: true},
+		{pattern: "**/*.png", name: "x/y/a.jpg"},
+		{pattern: "frames/**", name: "frames/a/b.png", matched: true},
+		{pattern: "frames/**/b.png", name: "frames/b.png", matched: true},
+		{pattern: "frame_??.png", name: "frame_01.png", matched: true},
+		{pattern: "frame_??.png", name: "frame_001.png"},
+		{pattern: "[", name: "a", err: true},
+	}
+	for _, test := range tests {
+		matched, err := matchGlob(test.pattern, test.name)
+		if (err != nil) != test.err {
+			t.Errorf("matchGlob(%q, %q) error = %v, want error %v", test.pattern, test.name, err, test.err)
+			continue
+		}
+		if matched != test.matched {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", test.pattern, test.name, matched, test.matched)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// download fetches url into destination. Download URLs are pre-signed, so
+// the API token is not sent with them.
+func download(ctx context.Context, client *Client, url string, destination string) error {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.HTTPClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+
+	if err = os.MkdirAll(filepath.Dir(destination), 0755); err != nil {
+		return err
+	}
+	out, err := os.Create(destination)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, resp.Body); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// frameExtension guesses a turntable frame's extension from its URL.
+func frameExtension(rawURL string) string {
+	if parsed, err := url.Parse(rawURL); err == nil && path.Ext(parsed.Path) != "" {
+		return path.Ext(parsed.Path)
+	}
+	return ".jpg"
+}
+
+// exportRecord writes the record as product.json in directory and, unless
+// skipDownloads is set, downloads every file and preview the API gives a URL
+// for. Turntable frames are written to a directory named after the preview.
+func exportRecord(ctx context.Context, client *Client, record *RemoteRecord, directory string, skipDownloads bool) error {
+	bundle := record.Bundle(directory)
+	if err := os.MkdirAll(directory, 0755); err != nil {
+		return err
+	}
+
+	if !skipDownloads {
+		missing := 0
+		fetch := func(fileId int, name string) error {
+			url := record.DownloadURLs[fileId]
+			if url == "" {
+				missing++
+				logger.Warn("No download URL", "file", name, "file_id", fileId)
+				return nil
+			}
+			if clean := filepath.Clean(name); filepath.IsAbs(clean) || strings.HasPrefix(clean, "..") {
+				return fmt.Errorf("file name %q is outside the product folder", name)
+			}
+			logger.Info("Downloading file", "file", name)
+			if err := download(ctx, client, url, filepath.Join(directory, name)); err != nil {
+				return fmt.Errorf("downloading %s: %s", name, err)
+			}
+			return nil
+		}
+		for _, file := range record.Files {
+			if err := fetch(file.FileId, file.Name); err != nil {
+				return err
+			}
+		}
+		for _, preview := range record.Previews {
+			if len(preview.FileIds) == 0 {
+				if err := fetch(preview.FileId, preview.Name); err != nil {
+					return err
+				}
+				continue
+			}
+			for i, fileId := range preview.FileIds {
+				frame := fmt.Sprintf("frame_%03d%s", i+1, frameExtension(record.DownloadURLs[fileId]))
+				if err := fetch(fileId, filepath.Join(preview.Name, frame)); err != nil {
+					return err
+				}
+			}
+		}
+		if missing > 0 {
+			logger.Warn("Some files were not downloaded", "count", missing)
+		}
+	}
+
+	output, err := json.MarshalIndent(bundle, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(directory, "product.json"), append(output, '\n'), 0644)
+}
+
+func runExport(command *Command, args []string) error {
+	flags := newCommandFlags(command)
+	directory := flags.String("dir", "", "Product folder to write. Defaults to product-<id>.")
+	skipDownloads := flags.Bool("no-download", false, "Write product.json without downloading files.")
+	force := flags.Bool("force", false, "Overwrite an existing product.json.")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	id, err := strconv.Atoi(flags.Arg(0))
+	if err != nil {
+		return fmt.Errorf("invalid product id %q", flags.Arg(0))
+	}
+	if *directory == "" {
+		*directory = fmt.Sprintf("product-%d", id)
+	}
+	if _, err := os.Stat(filepath.Join(*directory, "product.json")); err == nil && !*force {
+		return fmt.Errorf("%s already has a product.json, use -force to overwrite it", *directory)
+	}
+
+	ctx := context.Background()
+	client := NewClient(GetSettings())
+	record, err := fetchRecord(ctx, client, "product", id)
+	if err != nil {
+		return err
+	}
+	if err = exportRecord(ctx, client, record, *directory, *skipDownloads); err != nil {
+		return err
+	}
+	logger.Info("Exported product", "product_id", id, "dir", *directory)
+	return nil
+}
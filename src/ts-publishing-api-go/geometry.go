@@ -0,0 +1,359 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// geometryTolerance is how far, as a fraction of the measured value, a
+// declared polygon or vertex count may be off before a warning is logged.
+const geometryTolerance = 0.05
+
+// GeometryStats is what can be measured from a model file.
+type GeometryStats struct {
+	Polygons  int
+	Vertices  int
+	UVs       bool
+	Materials bool
+	Rigged    bool
+	Animated  bool
+}
+
+// geometryAnalyzers measure model files by extension.
+var geometryAnalyzers = map[string]func(path string) (GeometryStats, error){
+	".obj":  analyzeOBJ,
+	".stl":  analyzeSTL,
+	".ply":  analyzePLY,
+	".gltf": analyzeGLTF,
+	".glb":  analyzeGLB,
+}
+
+// geometryFlags lists the draft flags each format can express. A file that
+// does not show a flag only contradicts product.json when its format could
+// have shown it.
+var geometryFlags = map[string][]string{
+	".obj":  {"uv_mapped", "materials"},
+	".ply":  {"uv_mapped", "materials"},
+	".gltf": {"uv_mapped", "materials", "rigged", "animated"},
+	".glb":  {"uv_mapped", "materials", "rigged", "animated"},
+}
+
+// AnalyzeGeometry measures a model file. ok is false when the format is not
+// one that can be measured.
+func AnalyzeGeometry(path string) (stats GeometryStats, ok bool, err error) {
+	analyzer := geometryAnalyzers[strings.ToLower(filepath.Ext(path))]
+	if analyzer == nil {
+		return GeometryStats{}, false, nil
+	}
+	stats, err = analyzer(path)
+	return stats, true, err
+}
+
+func analyzeOBJ(path string) (GeometryStats, error) {
+	var stats GeometryStats
+	f, err := os.Open(path)
+	if err != nil {
+		return stats, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		keyword := line
+		if i := strings.IndexAny(line, " \t"); i >= 0 {
+			keyword = line[:i]
+		}
+		switch keyword {
+		case "v":
+			stats.Vertices++
+		case "f":
+			stats.Polygons++
+		case "vt":
+			stats.UVs = true
+		case "usemtl", "mtllib":
+			stats.Materials = true
+		}
+	}
+	return stats, scanner.Err()
+}
+
+// analyzeSTL counts triangles and distinct vertex positions, since STL
+// repeats every vertex for each triangle that uses it.
+func analyzeSTL(path string) (GeometryStats, error) {
+	var stats GeometryStats
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return stats, err
+	}
+
+	vertices := map[string]bool{}
+	if len(data) >= 84 {
+		count := int(binary.LittleEndian.Uint32(data[80:84]))
+		if 84+count*50 == len(data) {
+			for i := 0; i < count; i++ {
+				triangle := data[84+i*50:]
+				for v := 0; v < 3; v++ {
+					vertices[string(triangle[12+v*12:24+v*12])] = true
+				}
+			}
+			stats.Polygons = count
+			stats.Vertices = len(vertices)
+			return stats, nil
+		}
+	}
+
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("solid")) {
+		return stats, fmt.Errorf("not an STL file")
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "facet":
+			stats.Polygons++
+		case "vertex":
+			vertices[strings.Join(fields[1:], " ")] = true
+		}
+	}
+	stats.Vertices = len(vertices)
+	return stats, nil
+}
+
+// analyzePLY reads the counts and properties from a PLY header, which is
+// plain text for both ASCII and binary files.
+func analyzePLY(path string) (GeometryStats, error) {
+	var stats GeometryStats
+	f, err := os.Open(path)
+	if err != nil {
+		return stats, err
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	magic, err := reader.ReadString('\n')
+	if err != nil || strings.TrimSpace(magic) != "ply" {
+		return stats, fmt.Errorf("not a PLY file")
+	}
+	element := ""
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if err == io.EOF {
+				return stats, fmt.Errorf("PLY header has no end_header")
+			}
+			return stats, err
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "end_header":
+			return stats, nil
+		case "element":
+			if len(fields) < 3 {
+				return stats, fmt.Errorf("invalid PLY element %q", strings.TrimSpace(line))
+			}
+			element = fields[1]
+			count, err := strconv.Atoi(fields[2])
+			if err != nil {
+				return stats, fmt.Errorf("invalid PLY element %q", strings.TrimSpace(line))
+			}
+			switch element {
+			case "vertex":
+				stats.Vertices = count
+			case "face":
+				stats.Polygons = count
+			case "material":
+				stats.Materials = count > 0
+			}
+		case "property":
+			name := fields[len(fields)-1]
+			if element == "vertex" && (name == "u" || name == "s" || name == "texture_u") {
+				stats.UVs = true
+			}
+			if element == "face" && name == "texcoord" {
+				stats.UVs = true
+			}
+		}
+	}
+}
+
+type gltfDocument struct {
+	Accessors []struct {
+		Count int `json:"count"`
+	} `json:"accessors"`
+	Meshes []struct {
+		Primitives []struct {
+			Attributes map[string]int `json:"attributes"`
+			Indices    *int           `json:"indices"`
+			Mode       *int           `json:"mode"`
+		} `json:"primitives"`
+	} `json:"meshes"`
+	Materials  []json.RawMessage `json:"materials"`
+	Skins      []json.RawMessage `json:"skins"`
+	Animations []json.RawMessage `json:"animations"`
+}
+
+func analyzeGLTF(path string) (GeometryStats, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return GeometryStats{}, err
+	}
+	return gltfStats(data)
+}
+
+func analyzeGLB(path string) (GeometryStats, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return GeometryStats{}, err
+	}
+	if len(data) < 20 || string(data[:4]) != "glTF" || string(data[16:20]) != "JSON" {
+		return GeometryStats{}, fmt.Errorf("not a GLB file")
+	}
+	length := int(binary.LittleEndian.Uint32(data[12:16]))
+	if 20+length > len(data) {
+		return GeometryStats{}, fmt.Errorf("truncated GLB JSON chunk")
+	}
+	return gltfStats(data[20 : 20+length])
+}
+
+// gltfStats counts from accessor sizes, so buffers never need to be read.
+func gltfStats(data []byte) (GeometryStats, error) {
+	var stats GeometryStats
+	var document gltfDocument
+	if err := json.Unmarshal(data, &document); err != nil {
+		return stats, fmt.Errorf("not a glTF file: %s", err)
+	}
+	count := func(accessor int) (int, error) {
+		if accessor < 0 || accessor >= len(document.Accessors) {
+			return 0, fmt.Errorf("accessor %d does not exist", accessor)
+		}
+		return document.Accessors[accessor].Count, nil
+	}
+
+	for _, mesh := range document.Meshes {
+		for _, primitive := range mesh.Primitives {
+			position, ok := primitive.Attributes["POSITION"]
+			if !ok {
+				continue
+			}
+			vertices, err := count(position)
+			if err != nil {
+				return stats, err
+			}
+			stats.Vertices += vertices
+			if _, ok := primitive.Attributes["TEXCOORD_0"]; ok {
+				stats.UVs = true
+			}
+
+			elements := vertices
+			if primitive.Indices != nil {
+				if elements, err = count(*primitive.Indices); err != nil {
+					return stats, err
+				}
+			}
+			mode := 4
+			if primitive.Mode != nil {
+				mode = *primitive.Mode
+			}
+			switch mode {
+			case 4:
+				stats.Polygons += elements / 3
+			case 5, 6:
+				if elements > 2 {
+					stats.Polygons += elements - 2
+				}
+			}
+		}
+	}
+	stats.Materials = len(document.Materials) > 0
+	stats.Rigged = len(document.Skins) > 0
+	stats.Animated = len(document.Animations) > 0
+	return stats, nil
+}
+
+// analyzeGeometry measures the product files and fills in Draft fields that
+// were left out. Counts come from the first native file that can be
+// measured, or the first measurable file when no native one can.
+func (productBundle *ProductBundle) analyzeGeometry() {
+	var measured *GeometryStats
+	var source string
+	for _, native := range []bool{true, false} {
+		for _, file := range productBundle.Files {
+			if measured != nil {
+				break
+			}
+			if file.Type != "product_file" || file.Archive != "" || file.Native != native {
+				continue
+			}
+			stats, ok, err := AnalyzeGeometry(filepath.Join(productBundle.Directory, file.Name))
+			if err != nil {
+				logger.Warn("Unable to measure geometry", "file", file.Name, "error", err)
+				continue
+			}
+			if ok {
+				measured, source = &stats, file.Name
+			}
+		}
+	}
+	if measured == nil {
+		return
+	}
+	logger.Debug("Measured geometry", "file", source, "polygons", measured.Polygons, "vertices", measured.Vertices,
+		"uvs", measured.UVs, "materials", measured.Materials, "rigged", measured.Rigged, "animated", measured.Animated)
+
+	draft := &productBundle.Draft
+	fillCount(source, "polygons", &draft.Polygons, measured.Polygons)
+	fillCount(source, "vertices", &draft.Vertices, measured.Vertices)
+	expressed := geometryFlags[strings.ToLower(filepath.Ext(source))]
+	fillFlag(source, "uv_mapped", &draft.UVMapped, measured.UVs, expressed)
+	fillFlag(source, "materials", &draft.Materials, measured.Materials, expressed)
+	fillFlag(source, "rigged", &draft.Rigged, measured.Rigged, expressed)
+	fillFlag(source, "animated", &draft.Animated, measured.Animated, expressed)
+}
+
+// fillFlag sets a flag left out of product.json from the file, and warns
+// when a declared flag disagrees with it. A flag the file does not show is
+// only used when its format could have shown it.
+func fillFlag(source string, field string, declared **bool, measured bool, expressed []string) {
+	if !measured && !containsString(expressed, field) {
+		return
+	}
+	if *declared == nil {
+		*declared = &measured
+		return
+	}
+	if **declared != measured {
+		logger.Warn("Declared geometry differs from the file", "file", source, "field", field,
+			"declared", **declared, "measured", measured)
+	}
+}
+
+func fillCount(source string, field string, declared *int, measured int) {
+	if measured == 0 {
+		return
+	}
+	if *declared == 0 {
+		*declared = measured
+		return
+	}
+	if math.Abs(float64(*declared-measured))/float64(measured) > geometryTolerance {
+		logger.Warn("Declared geometry differs from the file", "file", source, "field", field,
+			"declared", *declared, "measured", measured)
+	}
+}
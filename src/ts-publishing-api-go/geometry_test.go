@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/jsonapi"
+)
+
+// binarySTL builds a binary STL file from triangles of three vertices each.
+func binarySTL(triangles [][3][3]float32) []byte {
+	var buffer bytes.Buffer
+	buffer.Write(make([]byte, 80))
+	binary.Write(&buffer, binary.LittleEndian, uint32(len(triangles)))
+	for _, triangle := range triangles {
+		buffer.Write(make([]byte, 12))
+		for _, vertex := range triangle {
+			for _, coordinate := range vertex {
+				binary.Write(&buffer, binary.LittleEndian, math.Float32bits(coordinate))
+			}
+		}
+		buffer.Write(make([]byte, 2))
+	}
+	return buffer.Bytes()
+}
+
+const testGLTF = `{
+	"asset": {"version": "2.0"},
+	"accessors": [{"count": 4}, {"count": 6}, {"count": 5}],
+	"meshes": [{"primitives": [
+		{"attributes": {"POSITION": 0, "TEXCOORD_0": 0}, "indices": 1},
+		{"attributes": {"POSITION": 2}, "mode": 5},
+		{"attributes": {"NORMAL": 0}}
+	]}],
+	"materials": [{}],
+	"skins": [{}]
+}`
+
+func TestAnalyzeGeometry(t *testing.T) {
+	square := [][3][3]float32{
+		{{0, 0, 0}, {1, 0, 0}, {1, 1, 0}},
+		{{0, 0, 0}, {1, 1, 0}, {0, 1, 0}},
+	}
+	tests := []struct {
+		name  string
+		data  []byte
+		stats GeometryStats
+		err   bool
+	}{
+		{
+			name:  "model.obj",
+			data:  []byte("mtllib model.mtl\nv 0 0 0\nv 1 0 0\nv 1 1 0\nv 0 1 0\nvt 0 0\nusemtl wood\nf 1 2 3\nf 1 3 4\n"),
+			stats: GeometryStats{Polygons: 2, Vertices: 4, UVs: true, Materials: true},
+		},
+		{
+			name:  "plain.obj",
+			data:  []byte("# comment\nv 0 0 0\nv 1 0 0\nv 1 1 0\nf 1 2 3\n"),
+			stats: GeometryStats{Polygons: 1, Vertices: 3},
+		},
+		{
+			name: "ascii.stl",
+			data: []byte("solid square\n" +
+				"facet normal 0 0 1\nouter loop\nvertex 0 0 0\nvertex 1 0 0\nvertex 1 1 0\nendloop\nendfacet\n" +
+				"facet normal 0 0 1\nouter loop\nvertex 0 0 0\nvertex 1 1 0\nvertex 0 1 0\nendloop\nendfacet\n" +
+				"endsolid square\n"),
+			stats: GeometryStats{Polygons: 2, Vertices: 4},
+		},
+		{
+			name:  "binary.stl",
+			data:  binarySTL(square),
+			stats: GeometryStats{Polygons: 2, Vertices: 4},
+		},
+		{
+			name: "not.stl",
+			data: []byte("hello"),
+			err:  true,
+		},
+		{
+			name: "model.ply",
+			data: []byte("ply\nformat binary_little_endian 1.0\ncomment made by hand\n" +
+				"element vertex 8\nproperty float x\nproperty float y\nproperty float z\nproperty float s\nproperty float t\n" +
+				"element face 6\nproperty list uchar int vertex_indices\n" +
+				"element material 1\nproperty uchar red\nend_header\n\x00\x01"),
+			stats: GeometryStats{Polygons: 6, Vertices: 8, UVs: true, Materials: true},
+		},
+		{
+			name:  "face-uvs.ply",
+			data:  []byte("ply\nformat ascii 1.0\nelement vertex 3\nproperty float x\nelement face 1\nproperty list uchar float texcoord\nend_header\n"),
+			stats: GeometryStats{Polygons: 1, Vertices: 3, UVs: true},
+		},
+		{
+			name: "truncated.ply",
+			data: []byte("ply\nformat ascii 1.0\nelement vertex 3\n"),
+			err:  true,
+		},
+		{
+			name: "bad-count.ply",
+			data: []byte("ply\nformat ascii 1.0\nelement vertex many\nend_header\n"),
+			err:  true,
+		},
+		{
+			name:  "model.gltf",
+			data:  []byte(testGLTF),
+			stats: GeometryStats{Polygons: 5, Vertices: 9, UVs: true, Materials: true, Rigged: true},
+		},
+		{
+			name:  "animated.glb",
+			data:  glb(`{"accessors": [{"count": 3}], "meshes": [{"primitives": [{"attributes": {"POSITION": 0}}]}], "animations": [{}]}`),
+			stats: GeometryStats{Polygons: 1, Vertices: 3, Animated: true},
+		},
+		{
+			name: "missing-accessor.gltf",
+			data: []byte(`{"meshes": [{"primitives": [{"attributes": {"POSITION": 3}}]}]}`),
+			err:  true,
+		},
+		{
+			name: "not.glb",
+			data: []byte("glTF"),
+			err:  true,
+		},
+	}
+	for _, test := range tests {
+		path := writeTestFile(t, test.name, test.data)
+		stats, ok, err := AnalyzeGeometry(path)
+		os.RemoveAll(filepath.Dir(path))
+		if !ok {
+			t.Errorf("%s: AnalyzeGeometry could not measure the format", test.name)
+			continue
+		}
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: AnalyzeGeometry = %+v, want an error", test.name, stats)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: AnalyzeGeometry returned %s", test.name, err)
+		} else if stats != test.stats {
+			t.Errorf("%s: AnalyzeGeometry = %+v, want %+v", test.name, stats, test.stats)
+		}
+	}
+
+	if _, ok, _ := AnalyzeGeometry("model.fbx"); ok {
+		t.Errorf("AnalyzeGeometry measured an FBX file")
+	}
+}
+
+// TestDraftFlagsPayload checks that the five geometry flags are sent the same
+// way: left out when unknown, and sent when true or explicitly false.
+func TestDraftFlagsPayload(t *testing.T) {
+	yes, no := true, false
+	draft := Draft{Name: "Chair", Textures: &no, UVMapped: &yes, Materials: &no}
+
+	var message bytes.Buffer
+	if err := jsonapi.MarshalPayloadWithoutIncluded(&message, &draft); err != nil {
+		t.Fatal(err)
+	}
+	var payload struct {
+		Data struct {
+			Attributes map[string]interface{} `json:"attributes"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(message.Bytes(), &payload); err != nil {
+		t.Fatal(err)
+	}
+	attributes := payload.Data.Attributes
+	for field, want := range map[string]interface{}{"textures": false, "uv_mapped": true, "materials": false} {
+		if value, ok := attributes[field]; !ok || value != want {
+			t.Errorf("%s is %v (present %v), want %v", field, value, ok, want)
+		}
+	}
+	for _, field := range []string{"rigged", "animated"} {
+		if value, ok := attributes[field]; ok {
+			t.Errorf("unset %s was sent as %v", field, value)
+		}
+	}
+}
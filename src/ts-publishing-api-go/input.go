@@ -1,20 +1,23 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
-	"log"
 	"os"
 	"path/filepath"
 )
 
 type ProductBundle struct {
-	Directory      string
-	Draft          Draft     `json:"product"`
-	Files          []File    `json:"files"`
-	Previews       []Preview `json:"previews"`
-	Certifications []string  `json:"certifications"`
+	Directory      string        `json:"-"`
+	Draft          Draft         `json:"product"`
+	Files          []File        `json:"files"`
+	Previews       []Preview     `json:"previews"`
+	Certifications []string      `json:"certifications"`
+	Categories     []CategoryRef `json:"categories"`
+	// Vars are values for templates in the draft's name, tags and
+	// description.
+	Vars map[string]interface{} `json:"vars"`
 }
 
 func NewProductBundle(directory string) ProductBundle {
@@ -25,24 +28,31 @@ func NewProductBundle(directory string) ProductBundle {
 }
 
 type Draft struct {
-	Id           int      `jsonapi:"primary,draft,omitempty"`
-	Name         string   `json:"name" jsonapi:"attr,name"`
-	Type         string   `json:"product_type" jsonapi:"attr,product_type"`
-	PriceUsd     float32  `json:"price_usd"`
-	Price        Price    `jsonapi:"attr,price"`
-	Description  string   `json:"description" jsonapi:"attr,description"`
-	Status       string   `json:"status" jsonapi:"attr,status"`
-	License      string   `json:"license" jsonapi:"attr,license"`
-	Tags         []string `json:"tags" jsonapi:"attr,tags"`
-	Animated     bool     `json:"animated" jsonapi:"attr,animated"`
-	Geometry     string   `json:"geometry" jsonapi:"attr,geometry"`
-	Materials    bool     `json:"materials" jsonapi:"attr,materials"`
-	Polygons     int      `json:"polygons" jsonapi:"attr,polygons"`
-	Rigged       bool     `json:"rigged" jsonapi:"attr,rigged"`
-	Textures     bool     `json:"textures" jsonapi:"attr,textures"`
-	UnwrappedUVs string   `json:"unwrapped_u_vs" jsonapi:"attr,unwrapped_u_vs"`
-	UVMapped     bool     `json:"uv_mapped" jsonapi:"attr,uv_mapped"`
-	Vertices     int      `json:"vertices" jsonapi:"attr,vertices"`
+	Id           int          `json:"-" jsonapi:"primary,draft,omitempty"`
+	Name         string       `json:"name" jsonapi:"attr,name"`
+	Type         string       `json:"product_type" jsonapi:"attr,product_type"`
+	PriceUsd     DecimalPrice `json:"price_usd"`
+	PriceCents   *int         `json:"price_cents"`
+	Price        *Price       `json:"price,omitempty" jsonapi:"attr,price"`
+	Description  string       `json:"description" jsonapi:"attr,description"`
+	Status       string       `json:"status" jsonapi:"attr,status"`
+	License      string       `json:"license" jsonapi:"attr,license"`
+	Tags         []string     `json:"tags" jsonapi:"attr,tags"`
+	Animated     *bool        `json:"animated" jsonapi:"attr,animated,omitempty"`
+	Geometry     string       `json:"geometry" jsonapi:"attr,geometry"`
+	Materials    *bool        `json:"materials" jsonapi:"attr,materials,omitempty"`
+	Polygons     int          `json:"polygons" jsonapi:"attr,polygons"`
+	Rigged       *bool        `json:"rigged" jsonapi:"attr,rigged,omitempty"`
+	Textures     *bool        `json:"textures" jsonapi:"attr,textures,omitempty"`
+	UnwrappedUVs string       `json:"unwrapped_u_vs" jsonapi:"attr,unwrapped_u_vs"`
+	UVMapped     *bool        `json:"uv_mapped" jsonapi:"attr,uv_mapped,omitempty"`
+	Vertices     int          `json:"vertices" jsonapi:"attr,vertices"`
+	CategoryIds  []int        `json:"-" jsonapi:"attr,category_ids,omitempty"`
+	// DescriptionFile is a Markdown file, relative to the product folder,
+	// used as the description.
+	DescriptionFile string `json:"description_file"`
+	// descriptionSource is the description before Markdown conversion.
+	descriptionSource string
 }
 
 func NewDraft() Draft {
@@ -52,24 +62,10 @@ func NewDraft() Draft {
 	}
 }
 
-type Price struct {
-	Value       int    `json:"value"`
-	Currency    string `json:"currency"`
-	Denominator int    `json:"demonminator"`
-}
-
-func buildUsdPrice(usdPrice float32) Price {
-	denominator := 100
-	return Price{
-		Currency:    "USD",
-		Denominator: denominator,
-		Value:       int(usdPrice * float32(denominator)),
-	}
-}
-
 type File struct {
-	FileId          int
+	FileId          int    `json:",omitempty"`
 	Name            string `json:"file_name"`
+	Pattern         string `json:"pattern,omitempty"`
 	Type            string `json:"type"`
 	Format          string `json:"file_format"`
 	FormatVersion   string `json:"format_version"`
@@ -77,20 +73,32 @@ type File struct {
 	RendererVersion string `json:"renderer_version"`
 	Native          bool   `json:"is_native"`
 	Description     string `json:"description"`
+	Archive         string `json:"archive,omitempty"`
+	// Source is the generated archive to upload, when there is one.
+	Source string `json:"-"`
 }
 
 type Preview struct {
-	FileId        int
-	FileIds       []int
-	Name          string `json:"file_name"`
-	Type          string `json:"type"`
-	ThumbnailType string `json:"thumbnail_type"`
+	FileId        int                  `json:",omitempty"`
+	FileIds       []int                `json:",omitempty"`
+	Name          string               `json:"file_name"`
+	Type          string               `json:"type"`
+	ThumbnailType string               `json:"thumbnail_type"`
+	Process       *ThumbnailProcessing `json:"process"`
+	Frames        string               `json:"frames"`
+	SpriteSheet   *SpriteSheet         `json:"sprite_sheet"`
+	// Source is the processed copy of the file to upload, when there is one.
+	Source string `json:"-"`
+	// FramePaths are the turntable frames to upload, in order.
+	FramePaths []string `json:"-"`
 }
 
-func ReadInput(path string) ProductBundle {
+// ReadInput loads a product folder or product.json. vars override the
+// product's own template variables.
+func ReadInput(path string, vars map[string]string) ProductBundle {
 	fi, err := os.Stat(path)
 	if err != nil {
-		log.Fatalf("unable to find %s: %s", path, err)
+		logger.Fatal("Unable to find product", "path", path, "error", err)
 	}
 
 	productPath := path
@@ -101,17 +109,35 @@ func ReadInput(path string) ProductBundle {
 		directory = filepath.Dir(path)
 	}
 
-	jsonFile, err := ioutil.ReadFile(productPath)
+	jsonFile, err := loadProductJSON(productPath)
 	if err != nil {
-		log.Fatalf("unable to read %s: %s", productPath, err)
+		logger.Fatal("Unable to read product file", "path", productPath, "error", err)
 	}
 
 	var productBundle = NewProductBundle(directory)
-	if err = json.Unmarshal([]byte(jsonFile), &productBundle); err != nil {
-		log.Fatalf("Unable to parse json file: %s", err)
+	// UseNumber keeps numbers in vars as written, so 1000000 is not
+	// rendered as 1e+06.
+	decoder := json.NewDecoder(bytes.NewReader(jsonFile))
+	decoder.UseNumber()
+	if err = decoder.Decode(&productBundle); err != nil {
+		logger.Fatal("Unable to parse json file", "path", productPath, "error", err)
 	}
 
-	productBundle.Draft.Price = buildUsdPrice(productBundle.Draft.PriceUsd)
+	if err = productBundle.Draft.resolvePrice(); err != nil {
+		logger.Fatal("Invalid price", "path", productPath, "error", err)
+	}
+	if err = productBundle.expandFilePatterns(); err != nil {
+		logger.Fatal("Invalid files", "path", productPath, "error", err)
+	}
+	productBundle.inspectFileFormats()
+	productBundle.analyzeGeometry()
+	if err = productBundle.loadDescriptionFile(); err != nil {
+		logger.Fatal("Unable to read description", "path", productPath, "error", err)
+	}
+	if err = productBundle.expandTemplates(vars); err != nil {
+		logger.Fatal("Invalid template", "path", productPath, "error", err)
+	}
+	productBundle.prepareDescription()
 
 	return productBundle
 }
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// FormatInfo is the file metadata TurboSquid asks for on product files that
+// can be read from the file itself. Renderers are not recorded in a form
+// that can be read reliably, so renderer and renderer_version come only
+// from product.json.
+type FormatInfo struct {
+	Format        string
+	FormatVersion string
+}
+
+// formatsByExtension maps file extensions to TurboSquid file_format values.
+var formatsByExtension = map[string]string{
+	".fbx":   "fbx",
+	".obj":   "obj",
+	".gltf":  "gltf",
+	".glb":   "glb",
+	".stl":   "stl",
+	".3ds":   "3ds",
+	".dae":   "collada",
+	".blend": "blend",
+	".max":   "3ds_max",
+	".ma":    "maya",
+	".mb":    "maya",
+	".c4d":   "cinema_4d",
+	".ply":   "ply",
+	".usdz":  "usdz",
+}
+
+// headerSize is how much of a file is read to find its version.
+const headerSize = 64 * 1024
+
+// DetectFormat works out a file's format from its extension and, where the
+// format records one, its version from the file header.
+func DetectFormat(path string) (FormatInfo, error) {
+	extension := strings.ToLower(filepath.Ext(path))
+	info := FormatInfo{Format: formatsByExtension[extension]}
+	if info.Format == "" {
+		return info, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return info, err
+	}
+	defer f.Close()
+	header := make([]byte, headerSize)
+	n, err := io.ReadFull(f, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return info, err
+	}
+	header, err = header[:n], nil
+
+	switch extension {
+	case ".fbx":
+		info.FormatVersion, err = fbxVersion(header)
+	case ".gltf":
+		info.FormatVersion, err = gltfVersion(f, header)
+	case ".glb":
+		info.FormatVersion, err = glbVersion(header)
+	case ".stl":
+		info.FormatVersion = stlVariant(header)
+	case ".3ds":
+		info.FormatVersion, err = maxThreeDSVersion(header)
+	case ".dae":
+		info.FormatVersion, err = colladaVersion(header)
+	case ".blend":
+		info.FormatVersion, err = blendVersion(header)
+	}
+	return info, err
+}
+
+var fbxAsciiVersion = regexp.MustCompile(`FBX (\d+)\.(\d+)`)
+
+func fbxVersion(header []byte) (string, error) {
+	magic := []byte("Kaydara FBX Binary  \x00")
+	if bytes.HasPrefix(header, magic) {
+		if len(header) < 27 {
+			return "", fmt.Errorf("truncated FBX header")
+		}
+		version := binary.LittleEndian.Uint32(header[23:27])
+		return fmt.Sprintf("%d.%d", version/1000, version%1000/100), nil
+	}
+	if match := fbxAsciiVersion.FindSubmatch(header); match != nil {
+		return fmt.Sprintf("%s.%s", match[1], match[2]), nil
+	}
+	return "", fmt.Errorf("not an FBX file")
+}
+
+type gltfAsset struct {
+	Asset struct {
+		Version string `json:"version"`
+	} `json:"asset"`
+}
+
+func gltfVersion(f *os.File, header []byte) (string, error) {
+	var document gltfAsset
+	data := header
+	if len(header) == headerSize {
+		rest, err := ioutil.ReadAll(f)
+		if err != nil {
+			return "", err
+		}
+		data = append(header, rest...)
+	}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return "", fmt.Errorf("not a glTF file: %s", err)
+	}
+	return document.Asset.Version, nil
+}
+
+func glbVersion(header []byte) (string, error) {
+	if len(header) < 20 || string(header[:4]) != "glTF" {
+		return "", fmt.Errorf("not a GLB file")
+	}
+	length := binary.LittleEndian.Uint32(header[12:16])
+	if string(header[16:20]) != "JSON" || int(20+length) > len(header) {
+		return fmt.Sprintf("%d.0", binary.LittleEndian.Uint32(header[4:8])), nil
+	}
+	var document gltfAsset
+	if err := json.Unmarshal(header[20:20+length], &document); err != nil {
+		return "", fmt.Errorf("invalid GLB JSON chunk: %s", err)
+	}
+	return document.Asset.Version, nil
+}
+
+// stlVariant reports whether an STL file is ASCII or binary; STL has no
+// version.
+func stlVariant(header []byte) string {
+	if bytes.HasPrefix(bytes.TrimSpace(header), []byte("solid")) && bytes.Contains(header, []byte("facet")) {
+		return "ascii"
+	}
+	return "binary"
+}
+
+func maxThreeDSVersion(header []byte) (string, error) {
+	if len(header) < 16 || binary.LittleEndian.Uint16(header[0:2]) != 0x4D4D {
+		return "", fmt.Errorf("not a 3DS file")
+	}
+	if binary.LittleEndian.Uint16(header[6:8]) != 0x0002 {
+		return "", nil
+	}
+	return strconv.Itoa(int(binary.LittleEndian.Uint32(header[12:16]))), nil
+}
+
+func colladaVersion(header []byte) (string, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(header))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return "", fmt.Errorf("not a COLLADA file")
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			if start.Name.Local != "COLLADA" {
+				return "", fmt.Errorf("not a COLLADA file")
+			}
+			for _, attr := range start.Attr {
+				if attr.Name.Local == "version" {
+					return attr.Value, nil
+				}
+			}
+			return "", nil
+		}
+	}
+}
+
+// blendVersion reads the version from a .blend header such as
+// "BLENDER-v279", which is Blender 2.79. Gzip compressed files are read
+// through; newer zstd compressed files have no readable header.
+func blendVersion(header []byte) (string, error) {
+	if bytes.HasPrefix(header, []byte{0x1f, 0x8b}) {
+		reader, err := gzip.NewReader(bytes.NewReader(header))
+		if err != nil {
+			return "", err
+		}
+		unzipped := make([]byte, 12)
+		if _, err = io.ReadFull(bufio.NewReader(reader), unzipped); err != nil {
+			return "", fmt.Errorf("truncated compressed .blend file")
+		}
+		header = unzipped
+	}
+	if bytes.HasPrefix(header, []byte{0x28, 0xb5, 0x2f, 0xfd}) {
+		return "", nil
+	}
+	if len(header) < 12 || string(header[:7]) != "BLENDER" {
+		return "", fmt.Errorf("not a .blend file")
+	}
+	version, err := strconv.Atoi(string(header[9:12]))
+	if err != nil {
+		return "", fmt.Errorf("invalid .blend version %q", header[9:12])
+	}
+	return fmt.Sprintf("%d.%d", version/100, version%100), nil
+}
+
+// inspectFileFormats fills in missing format metadata on product files and
+// warns where the declared values disagree with the files themselves.
+func (productBundle *ProductBundle) inspectFileFormats() {
+	for i := range productBundle.Files {
+		file := &productBundle.Files[i]
+		if file.Type != "product_file" || file.Archive != "" {
+			continue
+		}
+		detected, err := DetectFormat(filepath.Join(productBundle.Directory, file.Name))
+		if err != nil {
+			logger.Warn("Unable to inspect file", "file", file.Name, "error", err)
+		}
+		fillDetected(file.Name, "file_format", &file.Format, detected.Format)
+		fillDetected(file.Name, "format_version", &file.FormatVersion, detected.FormatVersion)
+	}
+}
+
+func fillDetected(name string, field string, declared *string, detected string) {
+	if detected == "" {
+		return
+	}
+	if *declared == "" {
+		logger.Debug("Detected file metadata", "file", name, "field", field, "value", detected)
+		*declared = detected
+		return
+	}
+	if !strings.EqualFold(*declared, detected) {
+		logger.Warn("Declared file metadata differs from the file", "file", name, "field", field,
+			"declared", *declared, "detected", detected)
+	}
+}
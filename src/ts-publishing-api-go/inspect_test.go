@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// headerTest is one header and what a parser should read from it.
+type headerTest struct {
+	name    string
+	header  []byte
+	version string
+	err     bool
+}
+
+func runHeaderTests(t *testing.T, parser string, parse func([]byte) (string, error), tests []headerTest) {
+	for _, test := range tests {
+		version, err := parse(test.header)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s(%s) = %q, want an error", parser, test.name, version)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s(%s) returned %s", parser, test.name, err)
+		} else if version != test.version {
+			t.Errorf("%s(%s) = %q, want %q", parser, test.name, version, test.version)
+		}
+	}
+}
+
+func uint32Bytes(value uint32) []byte {
+	data := make([]byte, 4)
+	binary.LittleEndian.PutUint32(data, value)
+	return data
+}
+
+func gzipped(data []byte) []byte {
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	writer.Write(data)
+	writer.Close()
+	return buffer.Bytes()
+}
+
+// writeTestFile writes data to name in a new temporary directory and returns
+// the file's path. The caller removes filepath.Dir of the path.
+func writeTestFile(t *testing.T, name string, data []byte) string {
+	dir, err := ioutil.TempDir("", "ts-publishing-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err = ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// glb wraps a glTF JSON document in a GLB container.
+func glb(document string) []byte {
+	for len(document)%4 != 0 {
+		document += " "
+	}
+	var buffer bytes.Buffer
+	buffer.WriteString("glTF")
+	binary.Write(&buffer, binary.LittleEndian, uint32(2))
+	binary.Write(&buffer, binary.LittleEndian, uint32(20+len(document)))
+	binary.Write(&buffer, binary.LittleEndian, uint32(len(document)))
+	buffer.WriteString("JSON")
+	buffer.WriteString(document)
+	return buffer.Bytes()
+}
+
+func TestFBXVersion(t *testing.T) {
+	binaryHeader := append([]byte("Kaydara FBX Binary  \x00\x1a\x00"), uint32Bytes(7400)...)
+	runHeaderTests(t, "fbxVersion", fbxVersion, []headerTest{
+		{name: "binary", header: binaryHeader, version: "7.4"},
+		{name: "ascii", header: []byte("; FBX 7.3.0 project file\n"), version: "7.3"},
+		{name: "truncated", header: []byte("Kaydara FBX Binary  \x00\x1a"), err: true},
+		{name: "other", header: []byte("hello"), err: true},
+	})
+}
+
+func TestGLBVersion(t *testing.T) {
+	noJSON := append(append([]byte("glTF"), uint32Bytes(2)...), make([]byte, 12)...)
+	runHeaderTests(t, "glbVersion", glbVersion, []headerTest{
+		{name: "json chunk", header: glb(`{"asset": {"version": "2.0"}}`), version: "2.0"},
+		{name: "container only", header: noJSON, version: "2.0"},
+		{name: "other", header: []byte("glTF"), err: true},
+	})
+}
+
+func TestStlVariant(t *testing.T) {
+	tests := []struct {
+		header  string
+		variant string
+	}{
+		{"solid cube\nfacet normal 0 0 1\n", "ascii"},
+		{"  solid cube\n  facet normal 0 0 1\n", "ascii"},
+		// Binary files may start with "solid" in their 80 byte header.
+		{"solid exported by a tool\x00\x00\x00\x00", "binary"},
+		{"\x00\x00\x00\x00", "binary"},
+	}
+	for _, test := range tests {
+		if variant := stlVariant([]byte(test.header)); variant != test.variant {
+			t.Errorf("stlVariant(%q) = %q, want %q", test.header, variant, test.variant)
+		}
+	}
+}
+
+func TestMaxThreeDSVersion(t *testing.T) {
+	header := func(chunk uint16, version uint32) []byte {
+		data := make([]byte, 16)
+		binary.LittleEndian.PutUint16(data[0:2], 0x4D4D)
+		binary.LittleEndian.PutUint16(data[6:8], chunk)
+		binary.LittleEndian.PutUint32(data[12:16], version)
+		return data
+	}
+	runHeaderTests(t, "maxThreeDSVersion", maxThreeDSVersion, []headerTest{
+		{name: "version chunk", header: header(0x0002, 3), version: "3"},
+		{name: "other chunk", header: header(0x3D3D, 3), version: ""},
+		{name: "other", header: make([]byte, 16), err: true},
+		{name: "truncated", header: []byte{0x4D, 0x4D}, err: true},
+	})
+}
+
+func TestColladaVersion(t *testing.T) {
+	runHeaderTests(t, "colladaVersion", colladaVersion, []headerTest{
+		{name: "1.4.1", header: []byte(`<?xml version="1.0"?><COLLADA xmlns="http://www.collada.org/2005/11/COLLADASchema" version="1.4.1">`), version: "1.4.1"},
+		{name: "no version", header: []byte(`<COLLADA>`), version: ""},
+		{name: "other xml", header: []byte(`<scene version="1">`), err: true},
+		{name: "other", header: []byte("hello"), err: true},
+	})
+}
+
+func TestBlendVersion(t *testing.T) {
+	runHeaderTests(t, "blendVersion", blendVersion, []headerTest{
+		{name: "2.79", header: []byte("BLENDER-v279REND"), version: "2.79"},
+		{name: "3.6", header: []byte("BLENDER_v306REND"), version: "3.6"},
+		{name: "gzip", header: gzipped([]byte("BLENDER-v283REND")), version: "2.83"},
+		{name: "zstd", header: []byte{0x28, 0xb5, 0x2f, 0xfd, 0x00}, version: ""},
+		{name: "bad version", header: []byte("BLENDER-vabcREND"), err: true},
+		{name: "other", header: []byte("hello world!"), err: true},
+	})
+}
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		info FormatInfo
+	}{
+		{"model.gltf", []byte(`{"asset": {"version": "2.0"}}`), FormatInfo{Format: "gltf", FormatVersion: "2.0"}},
+		{"MODEL.STL", []byte("solid a\nfacet normal 0 0 1\n"), FormatInfo{Format: "stl", FormatVersion: "ascii"}},
+		{"model.max", []byte("anything"), FormatInfo{Format: "3ds_max"}},
+		{"notes.txt", []byte("anything"), FormatInfo{}},
+	}
+	for _, test := range tests {
+		path := writeTestFile(t, test.name, test.data)
+		info, err := DetectFormat(path)
+		os.RemoveAll(filepath.Dir(path))
+		if err != nil {
+			t.Errorf("DetectFormat(%s) returned %s", test.name, err)
+		} else if info != test.info {
+			t.Errorf("DetectFormat(%s) = %+v, want %+v", test.name, info, test.info)
+		}
+	}
+}
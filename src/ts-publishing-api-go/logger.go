@@ -0,0 +1,268 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is a logging severity. Lower values are more verbose.
+type Level int
+
+const (
+	LevelTrace Level = -8
+	LevelDebug Level = -4
+	LevelInfo  Level = 0
+	LevelWarn  Level = 4
+	LevelError Level = 8
+)
+
+func (level Level) String() string {
+	switch level {
+	case LevelTrace:
+		return "TRACE"
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	}
+	return fmt.Sprintf("LEVEL(%d)", int(level))
+}
+
+// ParseLevel converts a -log-level flag value into a Level.
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "trace":
+		return LevelTrace, nil
+	case "debug":
+		return LevelDebug, nil
+	case "info", "":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q", name)
+}
+
+// Redacted replaces the value of every sensitive attribute.
+const Redacted = "[REDACTED]"
+
+// sensitiveKeys are attribute, header and JSON field names whose values are
+// never written to the log.
+var sensitiveKeys = map[string]bool{
+	"authorization":        true,
+	"token":                true,
+	"access_key":           true,
+	"secret_key":           true,
+	"session_token":        true,
+	"x-amz-security-token": true,
+	"password":             true,
+}
+
+func isSensitive(key string) bool {
+	return sensitiveKeys[strings.ToLower(key)]
+}
+
+// Logger writes leveled, structured records as text or JSON. Attributes are
+// passed as alternating keys and values, in the style of log/slog.
+type Logger struct {
+	mu     *sync.Mutex
+	out    io.Writer
+	level  Level
+	json   bool
+	attrs  []interface{}
+	exitFn func(int)
+}
+
+func NewLogger(out io.Writer, level Level, format string) (*Logger, error) {
+	if format != "" && format != "text" && format != "json" {
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+	return &Logger{
+		mu:     &sync.Mutex{},
+		out:    out,
+		level:  level,
+		json:   format == "json",
+		exitFn: os.Exit,
+	}, nil
+}
+
+// logger is the process wide logger, replaced in main once flags are parsed.
+var logger, _ = NewLogger(os.Stderr, LevelInfo, "text")
+
+// With returns a logger that adds args to every record.
+func (l *Logger) With(args ...interface{}) *Logger {
+	child := *l
+	child.attrs = append(append([]interface{}{}, l.attrs...), args...)
+	return &child
+}
+
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.level
+}
+
+func (l *Logger) Trace(msg string, args ...interface{}) { l.Log(LevelTrace, msg, args...) }
+func (l *Logger) Debug(msg string, args ...interface{}) { l.Log(LevelDebug, msg, args...) }
+func (l *Logger) Info(msg string, args ...interface{})  { l.Log(LevelInfo, msg, args...) }
+func (l *Logger) Warn(msg string, args ...interface{})  { l.Log(LevelWarn, msg, args...) }
+func (l *Logger) Error(msg string, args ...interface{}) { l.Log(LevelError, msg, args...) }
+
+// Fatal logs at error level and exits the process.
+func (l *Logger) Fatal(msg string, args ...interface{}) {
+	l.Log(LevelError, msg, args...)
+	l.exitFn(1)
+}
+
+func (l *Logger) Log(level Level, msg string, args ...interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	keys, values := pairs(append(append([]interface{}{}, l.attrs...), args...))
+
+	var line []byte
+	if l.json {
+		record := map[string]interface{}{
+			"time":  time.Now().Format(time.RFC3339Nano),
+			"level": level.String(),
+			"msg":   msg,
+		}
+		for i, key := range keys {
+			record[key] = jsonValue(values[i])
+		}
+		line, _ = json.Marshal(record)
+	} else {
+		var b strings.Builder
+		b.WriteString("time=")
+		b.WriteString(time.Now().Format(time.RFC3339))
+		b.WriteString(" level=")
+		b.WriteString(level.String())
+		b.WriteString(" msg=")
+		b.WriteString(quote(msg))
+		for i, key := range keys {
+			b.WriteString(" ")
+			b.WriteString(key)
+			b.WriteString("=")
+			b.WriteString(quote(textValue(values[i])))
+		}
+		line = []byte(b.String())
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.out.Write(append(line, '\n'))
+}
+
+// pairs splits alternating key/value args and redacts sensitive values. A
+// trailing key without a value is reported under "!BADKEY".
+func pairs(args []interface{}) ([]string, []interface{}) {
+	var keys []string
+	var values []interface{}
+	for i := 0; i < len(args); i += 2 {
+		key, ok := args[i].(string)
+		if !ok || i+1 == len(args) {
+			keys = append(keys, "!BADKEY")
+			values = append(values, args[i])
+			i--
+			continue
+		}
+		value := args[i+1]
+		if isSensitive(key) {
+			value = Redacted
+		}
+		keys = append(keys, key)
+		values = append(values, value)
+	}
+	return keys, values
+}
+
+func jsonValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.RawMessage:
+		if json.Valid(v) {
+			return v
+		}
+		return string(v)
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	}
+	return value
+}
+
+func textValue(value interface{}) string {
+	switch v := value.(type) {
+	case json.RawMessage:
+		return string(v)
+	case []byte:
+		return string(v)
+	case map[string]string:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+	return fmt.Sprint(value)
+}
+
+func quote(s string) string {
+	if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// RedactHeaders returns a copy of header with sensitive values replaced.
+func RedactHeaders(header http.Header) map[string]string {
+	redacted := make(map[string]string, len(header))
+	for name, values := range header {
+		if isSensitive(name) {
+			redacted[name] = Redacted
+		} else {
+			redacted[name] = strings.Join(values, ", ")
+		}
+	}
+	return redacted
+}
+
+// RedactJSON replaces sensitive fields anywhere in a JSON document. Bodies
+// that are not JSON are returned unchanged.
+func RedactJSON(body []byte) []byte {
+	var document interface{}
+	if err := json.Unmarshal(body, &document); err != nil {
+		return body
+	}
+	redacted, err := json.Marshal(redactValue(document))
+	if err != nil {
+		return body
+	}
+	return redacted
+}
+
+func redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if isSensitive(key) {
+				v[key] = Redacted
+			} else {
+				v[key] = redactValue(child)
+			}
+		}
+	case []interface{}:
+		for i, child := range v {
+			v[i] = redactValue(child)
+		}
+	}
+	return value
+}
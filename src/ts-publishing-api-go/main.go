@@ -1,107 +1,200 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"io/ioutil"
-	"log"
+	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
-	"strings"
+	"syscall"
+	"time"
 )
 
 const VERSION = "1.2.1"
 
 type Params struct {
-	Path    string
-	Publish bool
+	Path           string
+	Publish        bool
+	DeleteOnCancel bool
+	LogLevel       string
+	LogFormat      string
+	Record         string
+	Replay         string
+	Vars           varFlags
+	Only           stepList
+	Skip           stepList
+	Plan           bool
+	DraftId        int
 }
 
 func ParseParams() Params {
-	var params Params
+	params := Params{Vars: varFlags{}}
 	binName := filepath.Base(os.Args[0])
 	flag.StringVar(&params.Path, "path", "", "Path to product folder")
 	flag.BoolVar(&params.Publish, "publish", false, "Publish draft after creation.")
+	flag.StringVar(&params.LogLevel, "log-level", "", "Log level: trace, debug, info, warn or error. Defaults to debug when settings.yml enables debug, otherwise info.")
+	flag.StringVar(&params.LogFormat, "log-format", "text", "Log format: text or json.")
+	flag.StringVar(&params.Record, "record", "", "Save every API exchange, with secrets redacted, to this directory.")
+	flag.StringVar(&params.Replay, "replay", "", "Run offline against the exchanges recorded in this directory.")
+	flag.Var(params.Vars, "var", "Set a template variable as key=value. May be repeated.")
+	flag.Var(&params.Only, "only", "Run only these steps, comma separated: "+stepNames(publishSteps)+".")
+	flag.Var(&params.Skip, "skip", "Skip these steps, comma separated.")
+	flag.BoolVar(&params.Plan, "plan", false, "List the steps the run would go through without running them.")
+	flag.IntVar(&params.DraftId, "draft", 0, "Work on this existing draft instead of creating one, resuming a saved run for it.")
+	flag.BoolVar(&params.DeleteOnCancel, "delete-draft-on-cancel", false, "Delete the draft created during this run when it is interrupted.")
 	flag.Usage = func() {
 		fmt.Fprintf(flag.CommandLine.Output(), "\n%s %s:\n", binName, VERSION)
 		fmt.Fprintf(flag.CommandLine.Output(), "See project README.md for more information.\n")
 		fmt.Fprintf(flag.CommandLine.Output(), "\nArguments:\n")
 		flag.PrintDefaults()
+		printCommands()
 		fmt.Fprintf(flag.CommandLine.Output(), "\nExample:\n")
 		fmt.Fprintf(flag.CommandLine.Output(), "\t%s -path <project path>\n", binName)
 	}
 	flag.Parse()
+	return params
+}
 
-	if params.Path == "" {
-		flag.Usage()
-		os.Exit(0)
+// configureLogger replaces the default logger according to the -log-level
+// and -log-format flags.
+func configureLogger(params Params, settings Settings) error {
+	levelName := params.LogLevel
+	if levelName == "" && settings.Debug {
+		levelName = "debug"
 	}
-
-	return params
+	level, err := ParseLevel(levelName)
+	if err != nil {
+		return err
+	}
+	configured, err := NewLogger(os.Stderr, level, params.LogFormat)
+	if err != nil {
+		return err
+	}
+	logger = configured
+	return nil
 }
 
 func main() {
-	settings := GetSettings()
-
 	params := ParseParams()
+	// Commands take the logging flags given before their name, e.g.
+	// "-log-level debug diff ...".
+	if err := configureLogger(params, Settings{}); err != nil {
+		logger.Fatal("Invalid logging flags", "error", err)
+	}
+	if runCommand(flag.Args()) {
+		return
+	}
+	if params.Path == "" {
+		flag.Usage()
+		os.Exit(0)
+	}
 
-	productBundle := ReadInput(params.Path)
-	var credentials Credentials
-
-	if err := productBundle.Draft.createDraft(settings); err != nil {
-		log.Fatal("Error creating draft: ", err)
+	var settings Settings
+	var replay *ReplayTransport
+	if params.Replay != "" {
+		var err error
+		if replay, err = NewReplayTransport(params.Replay); err != nil {
+			logger.Fatal("Unable to load recording", "dir", params.Replay, "error", err)
+		}
+		settings = ReplaySettings(replay)
+	} else {
+		settings = GetSettings()
+	}
+	if err := configureLogger(params, settings); err != nil {
+		logger.Fatal("Invalid logging flags", "error", err)
 	}
 
-	for _, file := range productBundle.Files {
-		log.Printf("Uploading file: %s", file.Name)
-		err, fileId := credentials.Upload(productBundle.Directory, file.Name, settings)
+	productBundle := ReadInput(params.Path, params.Vars)
+	client := NewClient(settings)
+	if replay != nil {
+		client.HTTPClient.Transport = replay
+	} else if params.Record != "" {
+		recorder, err := NewRecordingTransport(params.Record, http.DefaultTransport)
 		if err != nil {
-			log.Fatal("Error uploading file: ", err)
+			logger.Fatal("Unable to start recording", "dir", params.Record, "error", err)
 		}
-		file.FileId = fileId
-
-		productBundle.Draft.addFile(file, settings)
+		client.HTTPClient.Transport = recorder
+		if err = recorder.SaveSettings(settings); err != nil {
+			logger.Fatal("Unable to start recording", "dir", params.Record, "error", err)
+		}
+		logger.Info("Recording API exchanges", "dir", params.Record)
+	}
+	state := NewRunState(productBundle.Directory)
+	if params.DraftId > 0 {
+		if saved, err := LoadRunState(productBundle.Directory); err == nil && saved.DraftId == params.DraftId {
+			logger.Info("Resuming saved run", "draft_id", saved.DraftId, "steps", len(saved.Steps))
+			state = saved
+		}
+		productBundle.Draft.Id, state.DraftId = params.DraftId, params.DraftId
 	}
 
-	for _, preview := range productBundle.Previews {
-		if preview.Type == "thumbnail" {
-			err, fileId := credentials.Upload(productBundle.Directory, preview.Name, settings)
-			if err != nil {
-				log.Fatal("Error uploading preview: ", err)
-			}
-			preview.FileId = fileId
-
-			productBundle.Draft.addThumbnail(preview, settings)
-		} else if preview.Type == "turntable" {
-			files, err := ioutil.ReadDir(fmt.Sprintf("%s/%s", productBundle.Directory, preview.Name))
-			if err != nil {
-				log.Fatal("Error reading turntable directory: ", err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		logger.Warn("Received signal, stopping", "signal", sig)
+		cancel()
+		// A second signal stops a cleanup or state save that hangs.
+		sig = <-signals
+		logger.Warn("Received second signal, exiting", "signal", sig)
+		os.Exit(130)
+	}()
+
+	err := run(ctx, client, settings, params, &productBundle, state)
+	if err != nil && ctx.Err() != nil {
+		// Drafts given with -draft were not made by this run and are kept.
+		if params.DeleteOnCancel && state.DraftId > 0 && params.DraftId == 0 {
+			cleanupCtx, cleanupCancel := context.WithTimeout(context.Background(), 30*time.Second)
+			if err := productBundle.Draft.delete(cleanupCtx, client); err != nil {
+				logger.Error("Unable to delete draft", "draft_id", state.DraftId, "error", err)
+			} else {
+				state.DraftDeleted = true
 			}
-
-			for _, file := range files {
-				if strings.HasPrefix(file.Name(), ".") {
-					continue
-				}
-				err, fileId := credentials.Upload(productBundle.Directory, fmt.Sprintf("%s/%s", preview.Name, file.Name()), settings)
-				if err != nil {
-					log.Fatal("Error uploading turntable file: ", err)
-				}
-				preview.FileIds = append(preview.FileIds, fileId)
+			cleanupCancel()
+		}
+		state.report()
+		os.Exit(130)
+	}
+	if err != nil {
+		// Save what finished so the run can be resumed with -draft.
+		if state.DraftId > 0 {
+			if path, saveErr := state.Save(); saveErr == nil {
+				logger.Info("Run state saved, resume with -draft", "path", path, "draft_id", state.DraftId)
 			}
-
-			productBundle.Draft.addTurntable(preview, settings)
 		}
+		logger.Fatal(err.Error())
 	}
+}
 
-	if err := productBundle.Draft.certifications(settings, productBundle.Certifications); err != nil {
-		log.Fatal("Error setting certifications: ", err)
+func run(ctx context.Context, client *Client, settings Settings, params Params, productBundle *ProductBundle, state *RunState) error {
+	pipeline := Pipeline{Steps: publishSteps}
+	if err := commandHooks(&pipeline, settings.Hooks); err != nil {
+		return err
+	}
+	pipelineRun := &PipelineRun{
+		Client:   client,
+		Settings: settings,
+		Params:   params,
+		Bundle:   productBundle,
+		State:    state,
+	}
+	plan, err := pipeline.Plan(pipelineRun)
+	if err != nil {
+		return err
+	}
+	if params.Plan {
+		printPlan(plan)
+		return nil
 	}
 
-	if params.Publish {
-		err, productId := productBundle.Draft.publish(settings)
-		if err != nil {
-			log.Fatal("Error publishing product: ", err)
-		}
-		log.Printf("Successfully published product ID: %d", productId)
+	if pipelineRun.TempDir, err = ioutil.TempDir("", "ts-publishing-"); err != nil {
+		return err
 	}
+	defer os.RemoveAll(pipelineRun.TempDir)
+	return pipeline.Run(ctx, pipelineRun, plan)
 }
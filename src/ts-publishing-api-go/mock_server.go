@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/turbosquid/ts-publishing-api-go/mockapi"
+)
+
+// ruleFlags collects repeated -fail and -delay flags as mock server rules.
+type ruleFlags struct {
+	rules []*mockapi.Rule
+	delay bool
+}
+
+func (flags *ruleFlags) String() string {
+	return ""
+}
+
+// Set parses "[METHOD ]PATH=VALUE[xTIMES]", where VALUE is a status code for
+// -fail and a duration for -delay, e.g. "POST /api/drafts=500x2".
+func (flags *ruleFlags) Set(value string) error {
+	separator := strings.LastIndex(value, "=")
+	if separator < 0 {
+		return fmt.Errorf("expected [METHOD ]PATH=VALUE, got %q", value)
+	}
+	rule := &mockapi.Rule{Path: strings.TrimSpace(value[:separator])}
+	if fields := strings.Fields(rule.Path); len(fields) == 2 {
+		rule.Method = strings.ToUpper(fields[0])
+		rule.Path = fields[1]
+	}
+
+	setting := value[separator+1:]
+	if x := strings.LastIndex(setting, "x"); x > 0 {
+		times, err := strconv.Atoi(setting[x+1:])
+		if err != nil {
+			return fmt.Errorf("invalid repeat count in %q", value)
+		}
+		rule.Times = times
+		setting = setting[:x]
+	}
+
+	var err error
+	if flags.delay {
+		rule.Delay, err = time.ParseDuration(setting)
+	} else {
+		rule.Status, err = strconv.Atoi(setting)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid value in %q: %s", value, err)
+	}
+	flags.rules = append(flags.rules, rule)
+	return nil
+}
+
+func runMockServer(command *Command, args []string) error {
+	flags := newCommandFlags(command)
+	addr := flags.String("addr", "127.0.0.1:8080", "Address to listen on.")
+	token := flags.String("token", "", "Only accept this API token. Any token is accepted when empty.")
+	bucket := flags.String("bucket", "mock-bucket", "Bucket name returned with upload credentials.")
+	states := flags.String("upload-states", strings.Join(mockapi.DefaultUploadStates, ","), "Comma separated statuses reported by successive upload polls.")
+	requireObject := flags.Bool("require-object", false, "Fail uploads whose file was never sent to the S3 endpoint.")
+	failures := &ruleFlags{}
+	delays := &ruleFlags{delay: true}
+	flags.Var(failures, "fail", "Fail matching requests: '[METHOD ]PATH=STATUS[xTIMES]'. May be repeated.")
+	flags.Var(delays, "delay", "Delay matching requests: '[METHOD ]PATH=DURATION[xTIMES]'. May be repeated.")
+	flags.Parse(args)
+
+	server := mockapi.NewServer(mockapi.Options{
+		Token:         *token,
+		Bucket:        *bucket,
+		UploadStates:  strings.Split(*states, ","),
+		RequireObject: *requireObject,
+		Rules:         append(failures.rules, delays.rules...),
+	})
+
+	logger.Info("Mock TurboSquid API listening", "addr", *addr,
+		"server", fmt.Sprintf("http://%s", *addr), "s3_endpoint", fmt.Sprintf("http://%s/s3", *addr))
+	return http.ListenAndServe(*addr, server)
+}
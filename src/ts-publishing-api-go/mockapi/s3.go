@@ -0,0 +1,130 @@
+package mockapi
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// serveS3 implements the subset of the S3 REST API used by s3manager:
+// PutObject and the multipart create, upload part, complete and abort calls.
+// Requests are path-style: /s3/<bucket>/<key>.
+func (server *Server) serveS3(w http.ResponseWriter, r *http.Request) {
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/s3/"), "/", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		writeS3Error(w, http.StatusBadRequest, "InvalidRequest", "bucket and key are required")
+		return
+	}
+	name := parts[0] + "/" + parts[1]
+	query := r.URL.Query()
+	uploadId := query.Get("uploadId")
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	switch {
+	case r.Method == "GET":
+		body, ok := server.objects[name]
+		if !ok {
+			writeS3Error(w, http.StatusNotFound, "NoSuchKey", parts[1])
+			return
+		}
+		w.Header().Set("ETag", etag(body))
+		w.Write(body)
+	case r.Method == "PUT" && uploadId == "":
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			writeS3Error(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+			return
+		}
+		server.objects[name] = body
+		w.Header().Set("ETag", etag(body))
+		w.WriteHeader(http.StatusOK)
+	case r.Method == "POST" && hasQuery(r, "uploads"):
+		id := "mpu-" + server.id()
+		server.multipart[id] = map[int][]byte{}
+		writeXML(w, struct {
+			XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+			Bucket   string
+			Key      string
+			UploadId string
+		}{Bucket: parts[0], Key: parts[1], UploadId: id})
+	case r.Method == "PUT":
+		uploaded, ok := server.multipart[uploadId]
+		if !ok {
+			writeS3Error(w, http.StatusNotFound, "NoSuchUpload", uploadId)
+			return
+		}
+		number, _ := strconv.Atoi(query.Get("partNumber"))
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			writeS3Error(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+			return
+		}
+		uploaded[number] = body
+		w.Header().Set("ETag", etag(body))
+		w.WriteHeader(http.StatusOK)
+	case r.Method == "POST":
+		uploaded, ok := server.multipart[uploadId]
+		if !ok {
+			writeS3Error(w, http.StatusNotFound, "NoSuchUpload", uploadId)
+			return
+		}
+		var numbers []int
+		for number := range uploaded {
+			numbers = append(numbers, number)
+		}
+		sort.Ints(numbers)
+		var object []byte
+		for _, number := range numbers {
+			object = append(object, uploaded[number]...)
+		}
+		server.objects[name] = object
+		delete(server.multipart, uploadId)
+		writeXML(w, struct {
+			XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+			Bucket  string
+			Key     string
+			ETag    string
+		}{Bucket: parts[0], Key: parts[1], ETag: etag(object)})
+	case r.Method == "DELETE" && uploadId != "":
+		delete(server.multipart, uploadId)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeS3Error(w, http.StatusMethodNotAllowed, "MethodNotAllowed", r.Method)
+	}
+}
+
+func hasQuery(r *http.Request, name string) bool {
+	_, ok := r.URL.Query()[name]
+	return ok
+}
+
+func etag(body []byte) string {
+	sum := md5.Sum(body)
+	return fmt.Sprintf("%q", hex.EncodeToString(sum[:]))
+}
+
+func writeXML(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(xml.Header))
+	xml.NewEncoder(w).Encode(value)
+}
+
+func writeS3Error(w http.ResponseWriter, status int, code string, message string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	w.Write([]byte(xml.Header))
+	xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string
+		Message string
+	}{Code: code, Message: message})
+}
@@ -0,0 +1,588 @@
+// Package mockapi is an in-memory fake of the TurboSquid publishing API and
+// the S3 bucket uploads are sent to. It can be mounted on an
+// httptest.Server or run standalone with the mock-server command.
+package mockapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MediaType is the JSON:API media type of every API response.
+const MediaType = "application/vnd.api+json"
+
+// DefaultUploadStates are the statuses an upload reports on successive polls.
+var DefaultUploadStates = []string{"queued", "processing", "success"}
+
+// DefaultCategories is the category tree served when Options.Categories is
+// empty.
+var DefaultCategories = []*Resource{
+	category(1, "Furnishings", 0),
+	category(2, "Chair", 1),
+	category(3, "Office Chair", 2),
+	category(4, "Table", 1),
+	category(5, "Vehicles", 0),
+	category(6, "Car", 5),
+}
+
+func category(id int, name string, parentId int) *Resource {
+	attributes := map[string]interface{}{"name": name}
+	if parentId > 0 {
+		attributes["parent_id"] = parentId
+	}
+	return &Resource{Type: "category", Id: strconv.Itoa(id), Attributes: attributes}
+}
+
+// draftSubresources are the collections that can be attached to a draft.
+var draftSubresources = map[string]string{
+	"product_files":     "product_file",
+	"customer_files":    "customer_file",
+	"promotional_files": "promotional_file",
+	"texture_files":     "texture_file",
+	"viewer_files":      "viewer_file",
+	"thumbnails":        "thumbnail",
+	"turntables":        "turntable",
+	"videos":            "video",
+	"certifications":    "certification",
+}
+
+// Rule injects a failure or a delay into matching requests. Path is matched
+// with path.Match, so "/api/drafts/*/thumbnails" matches every draft. An
+// empty Method matches every method. Times limits how often the rule fires;
+// zero means always.
+type Rule struct {
+	Method string
+	Path   string
+	Status int
+	Delay  time.Duration
+	Times  int
+
+	fired int
+}
+
+// Options configure a Server.
+type Options struct {
+	// Token, when set, is the only API token accepted.
+	Token string
+	// Bucket is the S3 bucket handed out with upload credentials.
+	Bucket string
+	// UploadStates replaces DefaultUploadStates. The last state is sticky.
+	UploadStates []string
+	// RequireObject fails an upload whose key was never PUT to the S3
+	// endpoint.
+	RequireObject bool
+	Categories    []*Resource
+	Rules         []*Rule
+}
+
+// Resource is a JSON:API resource object.
+type Resource struct {
+	Type          string                 `json:"type"`
+	Id            string                 `json:"id,omitempty"`
+	Attributes    map[string]interface{} `json:"attributes,omitempty"`
+	Relationships map[string]interface{} `json:"relationships,omitempty"`
+}
+
+type document struct {
+	Data json.RawMessage `json:"data"`
+}
+
+type upload struct {
+	resource *Resource
+	polls    int
+}
+
+// Server is an http.Handler serving the fake API under /api and a path-style
+// S3 endpoint under /s3/<bucket>/<key>.
+type Server struct {
+	options Options
+
+	mu           sync.Mutex
+	nextId       int
+	drafts       map[string]*Resource
+	draftOrder   []string
+	attachments  map[string][]*Resource
+	products     map[string]*Resource
+	productOrder []string
+	uploads      map[string]*upload
+	objects      map[string][]byte
+	multipart    map[string]map[int][]byte
+	requests     []string
+}
+
+func NewServer(options Options) *Server {
+	if options.Bucket == "" {
+		options.Bucket = "mock-bucket"
+	}
+	if len(options.UploadStates) == 0 {
+		options.UploadStates = DefaultUploadStates
+	}
+	if len(options.Categories) == 0 {
+		options.Categories = DefaultCategories
+	}
+	return &Server{
+		options:     options,
+		drafts:      map[string]*Resource{},
+		attachments: map[string][]*Resource{},
+		products:    map[string]*Resource{},
+		uploads:     map[string]*upload{},
+		objects:     map[string][]byte{},
+		multipart:   map[string]map[int][]byte{},
+	}
+}
+
+// AddRule adds a failure or delay rule while the server is running.
+func (server *Server) AddRule(rule *Rule) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	server.options.Rules = append(server.options.Rules, rule)
+}
+
+// Requests returns "METHOD /path" for every request served so far.
+func (server *Server) Requests() []string {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	return append([]string{}, server.requests...)
+}
+
+// Draft returns a stored draft and everything attached to it.
+func (server *Server) Draft(id string) (*Resource, []*Resource) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	return server.drafts[id], server.attachments[id]
+}
+
+// Object returns the content stored under bucket/key.
+func (server *Server) Object(bucket string, key string) ([]byte, bool) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	data, ok := server.objects[bucket+"/"+key]
+	return data, ok
+}
+
+func (server *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	server.mu.Lock()
+	server.requests = append(server.requests, r.Method+" "+r.URL.Path)
+	rule := server.matchRule(r)
+	server.mu.Unlock()
+
+	if rule != nil {
+		if rule.Delay > 0 {
+			select {
+			case <-time.After(rule.Delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if rule.Status > 0 {
+			writeError(w, rule.Status, "injected failure")
+			return
+		}
+	}
+
+	if strings.HasPrefix(r.URL.Path, "/s3/") {
+		server.serveS3(w, r)
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, "/api/") {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if server.options.Token != "" && r.Header.Get("Authorization") != "Token "+server.options.Token {
+		writeError(w, http.StatusUnauthorized, "invalid token")
+		return
+	}
+	server.serveAPI(w, r)
+}
+
+func (server *Server) matchRule(r *http.Request) *Rule {
+	for _, rule := range server.options.Rules {
+		if rule.Method != "" && rule.Method != r.Method {
+			continue
+		}
+		if matched, _ := path.Match(rule.Path, r.URL.Path); !matched {
+			continue
+		}
+		if rule.Times > 0 && rule.fired >= rule.Times {
+			continue
+		}
+		rule.fired++
+		return rule
+	}
+	return nil
+}
+
+func (server *Server) serveAPI(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/"), "/"), "/")
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	switch {
+	case parts[0] == "drafts" && len(parts) == 1 && r.Method == "POST":
+		server.createDraft(w, r)
+	case parts[0] == "drafts" && len(parts) == 1 && r.Method == "GET":
+		server.list(w, r, server.draftOrder, server.drafts)
+	case parts[0] == "drafts" && len(parts) == 2 && r.Method == "GET":
+		server.show(w, server.drafts[parts[1]])
+	case parts[0] == "drafts" && len(parts) == 2 && r.Method == "DELETE":
+		server.deleteDraft(w, parts[1])
+	case parts[0] == "drafts" && len(parts) == 3:
+		server.draftSubresource(w, r, parts[1], parts[2])
+	case parts[0] == "products" && len(parts) == 1 && r.Method == "POST":
+		server.createProduct(w, r)
+	case parts[0] == "products" && len(parts) == 1 && r.Method == "GET":
+		server.list(w, r, server.productOrder, server.products)
+	case parts[0] == "products" && len(parts) == 2 && r.Method == "GET":
+		server.show(w, server.products[parts[1]])
+	case parts[0] == "products" && len(parts) == 2 && r.Method == "PATCH":
+		server.updateProduct(w, r, parts[1])
+	case parts[0] == "categories" && len(parts) == 1 && r.Method == "GET":
+		writeResources(w, server.options.Categories)
+	case parts[0] == "uploads" && len(parts) == 2 && parts[1] == "credentials" && r.Method == "POST":
+		server.credentials(w)
+	case parts[0] == "uploads" && len(parts) == 1 && r.Method == "POST":
+		server.createUpload(w, r)
+	case parts[0] == "uploads" && len(parts) == 2 && r.Method == "GET":
+		server.pollUpload(w, parts[1])
+	default:
+		writeError(w, http.StatusNotFound, fmt.Sprintf("no route for %s %s", r.Method, r.URL.Path))
+	}
+}
+
+func (server *Server) id() string {
+	server.nextId++
+	return strconv.Itoa(server.nextId)
+}
+
+func (server *Server) createDraft(w http.ResponseWriter, r *http.Request) {
+	resource, err := readResource(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	resource.Type = "draft"
+	resource.Id = server.id()
+	if resource.Attributes["created_at"] == nil {
+		resource.Attributes["created_at"] = time.Now().UTC().Format(time.RFC3339)
+	}
+	server.drafts[resource.Id] = resource
+	server.draftOrder = append(server.draftOrder, resource.Id)
+	writeResource(w, http.StatusCreated, resource)
+}
+
+func (server *Server) deleteDraft(w http.ResponseWriter, id string) {
+	if server.drafts[id] == nil {
+		writeError(w, http.StatusNotFound, "draft not found")
+		return
+	}
+	delete(server.drafts, id)
+	delete(server.attachments, id)
+	for i, draftId := range server.draftOrder {
+		if draftId == id {
+			server.draftOrder = append(server.draftOrder[:i], server.draftOrder[i+1:]...)
+			break
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (server *Server) draftSubresource(w http.ResponseWriter, r *http.Request, draftId string, collection string) {
+	resourceType, ok := draftSubresources[collection]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("unknown draft collection %s", collection))
+		return
+	}
+	if server.drafts[draftId] == nil {
+		writeError(w, http.StatusNotFound, "draft not found")
+		return
+	}
+
+	if r.Method == "GET" {
+		var matching []*Resource
+		for _, attachment := range server.attachments[draftId] {
+			if attachment.Type == resourceType {
+				matching = append(matching, attachment)
+			}
+		}
+		writeResources(w, matching)
+		return
+	}
+	if r.Method != "POST" {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	resource, err := readResource(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if resource.Type != resourceType {
+		writeError(w, http.StatusUnprocessableEntity, fmt.Sprintf("expected %s, got %s", resourceType, resource.Type))
+		return
+	}
+	upload, err := server.uploadForFile(resource.Attributes["file_id"])
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, fmt.Sprintf("file_id %s", err))
+		return
+	}
+	if upload != nil {
+		key, _ := upload.resource.Attributes["upload_key"].(string)
+		if resource.Attributes["file_name"] == nil {
+			resource.Attributes["file_name"] = path.Base(key)
+		}
+		resource.Attributes["download_url"] = server.downloadURL(r, key)
+	}
+	if fileIds, ok := resource.Attributes["file_ids"].([]interface{}); ok {
+		var urls []string
+		for i, fileId := range fileIds {
+			upload, err := server.uploadForFile(fileId)
+			if err != nil {
+				writeError(w, http.StatusUnprocessableEntity, fmt.Sprintf("file_ids[%d] %s", i, err))
+				return
+			}
+			if upload != nil {
+				key, _ := upload.resource.Attributes["upload_key"].(string)
+				urls = append(urls, server.downloadURL(r, key))
+			}
+		}
+		if len(urls) == len(fileIds) {
+			resource.Attributes["download_urls"] = urls
+		}
+	}
+	resource.Id = server.id()
+	server.attachments[draftId] = append(server.attachments[draftId], resource)
+	writeResource(w, http.StatusCreated, resource)
+}
+
+func (server *Server) createProduct(w http.ResponseWriter, r *http.Request) {
+	resource, err := readResource(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var relationship struct {
+		Data Resource `json:"data"`
+	}
+	data, _ := json.Marshal(resource.Relationships["draft"])
+	json.Unmarshal(data, &relationship)
+	draft := server.drafts[relationship.Data.Id]
+	if draft == nil {
+		writeError(w, http.StatusUnprocessableEntity, "draft not found")
+		return
+	}
+
+	product := &Resource{
+		Type:       "product",
+		Id:         server.id(),
+		Attributes: map[string]interface{}{},
+		Relationships: map[string]interface{}{
+			"draft": map[string]interface{}{"data": map[string]string{"type": "draft", "id": draft.Id}},
+		},
+	}
+	for key, value := range draft.Attributes {
+		product.Attributes[key] = value
+	}
+	server.products[product.Id] = product
+	server.productOrder = append(server.productOrder, product.Id)
+	writeResource(w, http.StatusCreated, product)
+}
+
+// updateProduct changes the attributes given in the request, such as status
+// when a product is taken offline.
+func (server *Server) updateProduct(w http.ResponseWriter, r *http.Request, id string) {
+	product := server.products[id]
+	if product == nil {
+		writeError(w, http.StatusNotFound, "product not found")
+		return
+	}
+	resource, err := readResource(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	for key, value := range resource.Attributes {
+		product.Attributes[key] = value
+	}
+	writeResource(w, http.StatusOK, product)
+}
+
+func (server *Server) list(w http.ResponseWriter, r *http.Request, order []string, resources map[string]*Resource) {
+	page, _ := strconv.Atoi(r.URL.Query().Get("page[number]"))
+	size, _ := strconv.Atoi(r.URL.Query().Get("page[size]"))
+	if page < 1 {
+		page = 1
+	}
+	if size < 1 {
+		size = 25
+	}
+	var items []*Resource
+	for i := (page - 1) * size; i < len(order) && i < page*size; i++ {
+		items = append(items, resources[order[i]])
+	}
+	links := map[string]interface{}{"next": nil}
+	if page*size < len(order) {
+		next := *r.URL
+		query := next.Query()
+		query.Set("page[number]", strconv.Itoa(page+1))
+		query.Set("page[size]", strconv.Itoa(size))
+		next.RawQuery = query.Encode()
+		links["next"] = next.String()
+	}
+	writeDocument(w, items, links)
+}
+
+func (server *Server) show(w http.ResponseWriter, resource *Resource) {
+	if resource == nil {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	writeResource(w, http.StatusOK, resource)
+}
+
+func (server *Server) credentials(w http.ResponseWriter) {
+	writeResource(w, http.StatusCreated, &Resource{
+		Type: "upload_credential",
+		Id:   server.id(),
+		Attributes: map[string]interface{}{
+			"key_prefix":    fmt.Sprintf("uploads/%d/", server.nextId),
+			"bucket":        server.options.Bucket,
+			"access_key":    "MOCKACCESSKEY",
+			"secret_key":    "MOCKSECRETKEY",
+			"session_token": "MOCKSESSIONTOKEN",
+			"expiration":    time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+			"region":        "us-east-1",
+		},
+	})
+}
+
+func (server *Server) createUpload(w http.ResponseWriter, r *http.Request) {
+	resource, err := readResource(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	key, _ := resource.Attributes["upload_key"].(string)
+	if key == "" {
+		writeError(w, http.StatusUnprocessableEntity, "upload_key is required")
+		return
+	}
+	resource.Type = "upload"
+	resource.Id = server.id()
+	resource.Attributes["status"] = server.options.UploadStates[0]
+	server.uploads[resource.Id] = &upload{resource: resource}
+	writeResource(w, http.StatusCreated, resource)
+}
+
+func (server *Server) pollUpload(w http.ResponseWriter, id string) {
+	upload := server.uploads[id]
+	if upload == nil {
+		writeError(w, http.StatusNotFound, "upload not found")
+		return
+	}
+	upload.polls++
+	states := server.options.UploadStates
+	state := states[len(states)-1]
+	if upload.polls < len(states) {
+		state = states[upload.polls]
+	}
+	key, _ := upload.resource.Attributes["upload_key"].(string)
+	if _, ok := server.objects[server.options.Bucket+"/"+key]; server.options.RequireObject && !ok {
+		state = "failed"
+		upload.resource.Attributes["message"] = "object not found"
+	}
+	upload.resource.Attributes["status"] = state
+	if state == "success" && upload.resource.Attributes["file_id"] == nil {
+		fileId, _ := strconv.Atoi(server.id())
+		upload.resource.Attributes["file_id"] = fileId
+	}
+	writeResource(w, http.StatusOK, upload.resource)
+}
+
+// downloadURL is where the fake bucket serves an uploaded object.
+func (server *Server) downloadURL(r *http.Request, key string) string {
+	return fmt.Sprintf("http://%s/s3/%s/%s", r.Host, server.options.Bucket, key)
+}
+
+// uploadForFile finds the finished upload that produced fileId, a number
+// decoded from JSON. A missing fileId finds nothing; one that is not a
+// number is an error.
+func (server *Server) uploadForFile(fileId interface{}) (*upload, error) {
+	if fileId == nil {
+		return nil, nil
+	}
+	id, ok := fileId.(float64)
+	if !ok {
+		return nil, fmt.Errorf("must be a number, got %v", fileId)
+	}
+	for _, upload := range server.uploads {
+		if uploaded, ok := upload.resource.Attributes["file_id"].(int); ok && float64(uploaded) == id {
+			return upload, nil
+		}
+	}
+	return nil, nil
+}
+
+func readResource(r *http.Request) (*Resource, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	var doc document
+	if err = json.Unmarshal(body, &doc); err != nil {
+		return nil, fmt.Errorf("invalid JSON:API document: %s", err)
+	}
+	var resource Resource
+	if err = json.Unmarshal(doc.Data, &resource); err != nil {
+		return nil, fmt.Errorf("invalid resource: %s", err)
+	}
+	if resource.Attributes == nil {
+		resource.Attributes = map[string]interface{}{}
+	}
+	return &resource, nil
+}
+
+func writeResource(w http.ResponseWriter, status int, resource *Resource) {
+	w.Header().Set("Content-Type", MediaType)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": resource})
+}
+
+func writeResources(w http.ResponseWriter, resources []*Resource) {
+	writeDocument(w, resources, nil)
+}
+
+// writeDocument writes a collection with optional top-level links.
+func writeDocument(w http.ResponseWriter, resources []*Resource, links map[string]interface{}) {
+	// Sort a copy: resources may be shared, such as DefaultCategories.
+	resources = append([]*Resource{}, resources...)
+	sort.SliceStable(resources, func(i, j int) bool {
+		a, _ := strconv.Atoi(resources[i].Id)
+		b, _ := strconv.Atoi(resources[j].Id)
+		return a < b
+	})
+	w.Header().Set("Content-Type", MediaType)
+	w.WriteHeader(http.StatusOK)
+	document := map[string]interface{}{"data": resources}
+	if links != nil {
+		document["links"] = links
+	}
+	json.NewEncoder(w).Encode(document)
+}
+
+func writeError(w http.ResponseWriter, status int, detail string) {
+	w.Header().Set("Content-Type", MediaType)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"errors": []map[string]string{{"status": strconv.Itoa(status), "title": http.StatusText(status), "detail": detail}},
+	})
+}
@@ -0,0 +1,271 @@
+package mockapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const testToken = "secret"
+
+// call sends a request to server and returns the status and the decoded
+// JSON:API data, if any.
+func call(t *testing.T, server *httptest.Server, method string, path string, body string) (int, map[string]interface{}) {
+	t.Helper()
+	req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Token "+testToken)
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var document struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	data, _ := ioutil.ReadAll(resp.Body)
+	json.Unmarshal(data, &document)
+	return resp.StatusCode, document.Data
+}
+
+func attributes(data map[string]interface{}) map[string]interface{} {
+	attributes, _ := data["attributes"].(map[string]interface{})
+	return attributes
+}
+
+func TestUploadStates(t *testing.T) {
+	tests := []struct {
+		name       string
+		options    Options
+		putObject  bool
+		initial    string
+		states     []string
+		wantFileId bool
+	}{
+		{
+			name:       "default states",
+			initial:    "queued",
+			states:     []string{"processing", "success", "success"},
+			wantFileId: true,
+		},
+		{
+			name:    "custom states stick on the last",
+			options: Options{UploadStates: []string{"queued", "failed"}},
+			initial: "queued",
+			states:  []string{"failed", "failed"},
+		},
+		{
+			name:    "require object without one",
+			options: Options{UploadStates: []string{"success"}, RequireObject: true},
+			initial: "success",
+			states:  []string{"failed"},
+		},
+		{
+			name:       "require object with one",
+			options:    Options{UploadStates: []string{"success"}, RequireObject: true},
+			putObject:  true,
+			initial:    "success",
+			states:     []string{"success"},
+			wantFileId: true,
+		},
+	}
+	for _, test := range tests {
+		test.options.Token = testToken
+		server := httptest.NewServer(NewServer(test.options))
+		if test.putObject {
+			call(t, server, "PUT", "/s3/mock-bucket/uploads/1/model.obj", "v 0 0 0")
+		}
+		status, created := call(t, server, "POST", "/api/uploads", `{"data": {"type": "upload", "attributes": {"upload_key": "uploads/1/model.obj"}}}`)
+		if status != http.StatusCreated {
+			t.Fatalf("%s: creating upload returned %d", test.name, status)
+		}
+		if state := attributes(created)["status"]; state != test.initial {
+			t.Errorf("%s: new upload is %v, want %s", test.name, state, test.initial)
+		}
+		var polled map[string]interface{}
+		for i, want := range test.states {
+			_, polled = call(t, server, "GET", "/api/uploads/"+created["id"].(string), "")
+			if state := attributes(polled)["status"]; state != want {
+				t.Errorf("%s: poll %d status = %v, want %s", test.name, i+1, state, want)
+			}
+		}
+		if _, ok := attributes(polled)["file_id"]; ok != test.wantFileId {
+			t.Errorf("%s: file_id set = %v, want %v", test.name, ok, test.wantFileId)
+		}
+		server.Close()
+	}
+}
+
+func TestValidation(t *testing.T) {
+	api := NewServer(Options{Token: testToken})
+	server := httptest.NewServer(api)
+	defer server.Close()
+	_, draft := call(t, server, "POST", "/api/drafts", `{"data": {"type": "draft", "attributes": {"name": "Chair"}}}`)
+	draftPath := "/api/drafts/" + draft["id"].(string)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"invalid document", "POST", "/api/drafts", `{`, http.StatusBadRequest},
+		{"upload without key", "POST", "/api/uploads", `{"data": {"type": "upload", "attributes": {}}}`, http.StatusUnprocessableEntity},
+		{"wrong attachment type", "POST", draftPath + "/thumbnails", `{"data": {"type": "turntable", "attributes": {}}}`, http.StatusUnprocessableEntity},
+		{"file_id not a number", "POST", draftPath + "/thumbnails", `{"data": {"type": "thumbnail", "attributes": {"file_id": "7"}}}`, http.StatusUnprocessableEntity},
+		{"file_ids not numbers", "POST", draftPath + "/turntables", `{"data": {"type": "turntable", "attributes": {"file_ids": [true]}}}`, http.StatusUnprocessableEntity},
+		{"unknown collection", "GET", draftPath + "/posters", "", http.StatusNotFound},
+		{"unknown draft", "GET", "/api/drafts/999/thumbnails", "", http.StatusNotFound},
+		{"unknown route", "GET", "/api/nothing", "", http.StatusNotFound},
+		{"product without draft", "POST", "/api/products", `{"data": {"type": "product", "relationships": {"draft": {"data": {"type": "draft", "id": "999"}}}}}`, http.StatusUnprocessableEntity},
+		{"attachment", "POST", draftPath + "/thumbnails", `{"data": {"type": "thumbnail", "attributes": {"file_name": "a.png"}}}`, http.StatusCreated},
+	}
+	for _, test := range tests {
+		if status, _ := call(t, server, test.method, test.path, test.body); status != test.status {
+			t.Errorf("%s: %s %s returned %d, want %d", test.name, test.method, test.path, status, test.status)
+		}
+	}
+	if _, attachments := api.Draft(draft["id"].(string)); len(attachments) != 1 {
+		t.Errorf("draft has %d attachments, want 1", len(attachments))
+	}
+
+	req, _ := http.NewRequest("GET", server.URL+"/api/drafts", nil)
+	req.Header.Set("Authorization", "Token wrong")
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("wrong token returned %d, want %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+}
+
+func TestRules(t *testing.T) {
+	api := NewServer(Options{Token: testToken, Rules: []*Rule{
+		{Method: "POST", Path: "/api/drafts/*/thumbnails", Status: http.StatusInternalServerError, Times: 1},
+	}})
+	api.AddRule(&Rule{Path: "/api/categories", Status: http.StatusServiceUnavailable})
+	server := httptest.NewServer(api)
+	defer server.Close()
+	_, draft := call(t, server, "POST", "/api/drafts", `{"data": {"type": "draft", "attributes": {}}}`)
+	thumbnails := "/api/drafts/" + draft["id"].(string) + "/thumbnails"
+	thumbnail := `{"data": {"type": "thumbnail", "attributes": {}}}`
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"GET", thumbnails, "", http.StatusOK},
+		{"POST", thumbnails, thumbnail, http.StatusInternalServerError},
+		{"POST", thumbnails, thumbnail, http.StatusCreated},
+		{"GET", "/api/categories", "", http.StatusServiceUnavailable},
+		{"GET", "/api/categories", "", http.StatusServiceUnavailable},
+	}
+	for i, test := range tests {
+		if status, _ := call(t, server, test.method, test.path, test.body); status != test.status {
+			t.Errorf("request %d: %s %s returned %d, want %d", i+1, test.method, test.path, status, test.status)
+		}
+	}
+}
+
+func TestS3Multipart(t *testing.T) {
+	api := NewServer(Options{})
+	server := httptest.NewServer(api)
+	defer server.Close()
+	send := func(method string, path string, body string) (int, []byte) {
+		req, _ := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		resp, err := server.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, _ := ioutil.ReadAll(resp.Body)
+		return resp.StatusCode, data
+	}
+	uploadId := func(data []byte) string {
+		start := bytes.Index(data, []byte("<UploadId>"))
+		end := bytes.Index(data, []byte("</UploadId>"))
+		if start < 0 || end < start {
+			t.Fatalf("no UploadId in %s", data)
+		}
+		return string(data[start+len("<UploadId>") : end])
+	}
+	object := "/s3/mock-bucket/uploads/1/model.zip"
+
+	_, created := send("POST", object+"?uploads", "")
+	id := uploadId(created)
+	steps := []struct {
+		method string
+		query  string
+		body   string
+		status int
+	}{
+		{"PUT", "?partNumber=2&uploadId=" + id, "world", http.StatusOK},
+		{"PUT", "?partNumber=1&uploadId=" + id, "hello ", http.StatusOK},
+		{"PUT", "?partNumber=1&uploadId=mpu-unknown", "lost", http.StatusNotFound},
+		{"POST", "?uploadId=" + id, "<CompleteMultipartUpload/>", http.StatusOK},
+		{"POST", "?uploadId=" + id, "<CompleteMultipartUpload/>", http.StatusNotFound},
+	}
+	for i, step := range steps {
+		if status, body := send(step.method, object+step.query, step.body); status != step.status {
+			t.Errorf("step %d: %s %s returned %d, want %d: %s", i+1, step.method, step.query, status, step.status, body)
+		}
+	}
+	if data, ok := api.Object("mock-bucket", "uploads/1/model.zip"); !ok || string(data) != "hello world" {
+		t.Errorf("completed object = %q, %v, want %q", data, ok, "hello world")
+	}
+	if status, data := send("GET", object, ""); status != http.StatusOK || string(data) != "hello world" {
+		t.Errorf("GET object returned %d %q", status, data)
+	}
+
+	_, created = send("POST", "/s3/mock-bucket/uploads/1/aborted.zip?uploads", "")
+	id = uploadId(created)
+	send("PUT", "/s3/mock-bucket/uploads/1/aborted.zip?partNumber=1&uploadId="+id, "part")
+	if status, _ := send("DELETE", "/s3/mock-bucket/uploads/1/aborted.zip?uploadId="+id, ""); status != http.StatusNoContent {
+		t.Errorf("abort returned %d", status)
+	}
+	if status, _ := send("POST", "/s3/mock-bucket/uploads/1/aborted.zip?uploadId="+id, ""); status != http.StatusNotFound {
+		t.Errorf("completing an aborted upload returned %d", status)
+	}
+	if _, ok := api.Object("mock-bucket", "uploads/1/aborted.zip"); ok {
+		t.Errorf("aborted upload was stored")
+	}
+}
+
+// TestServersShareCategories runs two servers over one unsorted category
+// slice, so the race detector catches sorting it in place.
+func TestServersShareCategories(t *testing.T) {
+	categories := []*Resource{DefaultCategories[2], DefaultCategories[0], DefaultCategories[1]}
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			server := httptest.NewServer(NewServer(Options{Categories: categories}))
+			defer server.Close()
+			for j := 0; j < 20; j++ {
+				resp, err := server.Client().Get(server.URL + "/api/categories")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				resp.Body.Close()
+			}
+		}()
+	}
+	wg.Wait()
+	if categories[0] != DefaultCategories[2] {
+		t.Errorf("serving categories reordered the caller's slice")
+	}
+}
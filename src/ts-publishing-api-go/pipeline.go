@@ -0,0 +1,418 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// PipelineRun is what the steps of one publishing run share.
+type PipelineRun struct {
+	Client   *Client
+	Settings Settings
+	Params   Params
+	Bundle   *ProductBundle
+	State    *RunState
+	// TempDir holds the resized thumbnails, turntable frames and archives.
+	TempDir     string
+	credentials Credentials
+}
+
+// upload uploads a file and returns its file ID.
+func (run *PipelineRun) upload(ctx context.Context, directory string, name string) (int, error) {
+	err, fileId := run.credentials.Upload(ctx, directory, name, run.Client, run.Settings)
+	return fileId, err
+}
+
+// Step is one named stage of a publishing run.
+type Step struct {
+	Name string
+	// Inputs and Outputs name what the step reads and produces, for -plan.
+	Inputs  []string
+	Outputs []string
+	// NeedsDraft is set for steps that change the draft, which must then be
+	// created by the draft step or given with -draft.
+	NeedsDraft bool
+	// Key returns the step's inputs. A run resumed with -draft skips a step
+	// that already finished with the same inputs.
+	Key func(run *PipelineRun) interface{}
+	// Prepare does the step's local work and checks. It runs for every step
+	// before any step changes the draft, so a product that cannot be
+	// published fails before anything is created.
+	Prepare func(ctx context.Context, run *PipelineRun) error
+	Run     func(ctx context.Context, run *PipelineRun) error
+}
+
+// StepHook runs before or after a step. An error stops the run.
+type StepHook func(ctx context.Context, step *Step, run *PipelineRun) error
+
+// Pipeline is the sequence of steps a publishing run goes through.
+type Pipeline struct {
+	Steps  []Step
+	Before []StepHook
+	After  []StepHook
+}
+
+// PlannedStep is a step with the key of its inputs and, when it will not
+// run, the reason.
+type PlannedStep struct {
+	Step *Step
+	Key  string
+	Skip string
+}
+
+// publishSteps are the steps of a run, in order.
+var publishSteps = []Step{
+	{
+		Name:    "draft",
+		Inputs:  []string{"draft attributes", "categories", "tags"},
+		Outputs: []string{"draft_id"},
+		Key:     func(run *PipelineRun) interface{} { return run.Bundle.Draft },
+		Prepare: prepareDraftStep,
+		Run:     runDraftStep,
+	},
+	{
+		Name:       "files",
+		Inputs:     []string{"files"},
+		Outputs:    []string{"file_ids"},
+		NeedsDraft: true,
+		Key:        func(run *PipelineRun) interface{} { return run.Bundle.Files },
+		Prepare: func(ctx context.Context, run *PipelineRun) error {
+			return prepareArchives(run.Bundle, run.TempDir, run.Settings.ArchiveCache)
+		},
+		Run: runFilesStep,
+	},
+	{
+		Name:       "previews",
+		Inputs:     []string{"previews"},
+		Outputs:    []string{"preview file_ids"},
+		NeedsDraft: true,
+		Key:        func(run *PipelineRun) interface{} { return run.Bundle.Previews },
+		Prepare:    preparePreviewsStep,
+		Run:        runPreviewsStep,
+	},
+	{
+		Name:       "certifications",
+		Inputs:     []string{"certifications"},
+		NeedsDraft: true,
+		Key:        func(run *PipelineRun) interface{} { return run.Bundle.Certifications },
+		Prepare: func(ctx context.Context, run *PipelineRun) error {
+			return checkCertifications(run.Bundle, certificationRequirementsFor(run.Settings))
+		},
+		Run: func(ctx context.Context, run *PipelineRun) error {
+			if err := run.Bundle.Draft.certifications(ctx, run.Client, run.Bundle.Certifications); err != nil {
+				return fmt.Errorf("Error setting certifications: %s", err)
+			}
+			run.State.Certifications = run.Bundle.Certifications
+			return nil
+		},
+	},
+	{
+		Name:       "publish",
+		Outputs:    []string{"product_id"},
+		NeedsDraft: true,
+		Key:        func(run *PipelineRun) interface{} { return nil },
+		Run: func(ctx context.Context, run *PipelineRun) error {
+			err, productId := run.Bundle.Draft.publish(ctx, run.Client)
+			if err != nil {
+				return fmt.Errorf("Error publishing product: %s", err)
+			}
+			run.State.ProductId = productId
+			logger.Info("Successfully published product", "product_id", productId)
+			return nil
+		},
+	},
+}
+
+func prepareDraftStep(ctx context.Context, run *PipelineRun) error {
+	if len(run.Bundle.Categories) > 0 {
+		tree, err := LoadCategoryTree(ctx, run.Client, false)
+		if err != nil {
+			return fmt.Errorf("Error loading categories: %s", err)
+		}
+		if run.Bundle.Draft.CategoryIds, err = tree.Resolve(run.Bundle.Categories); err != nil {
+			return err
+		}
+	}
+	if err := run.Bundle.Draft.checkDescription(); err != nil {
+		return err
+	}
+	points := run.Settings.PricePoints
+	if len(points) == 0 {
+		points = defaultPricePoints
+	}
+	if err := checkPricePoint(run.Bundle.Draft.price(), points); err != nil {
+		return err
+	}
+	return prepareTags(&run.Bundle.Draft, run.Settings.TagSynonyms)
+}
+
+func runDraftStep(ctx context.Context, run *PipelineRun) error {
+	if err := run.Bundle.Draft.createDraft(ctx, run.Client); err != nil {
+		return fmt.Errorf("Error creating draft: %s", err)
+	}
+	run.State.DraftId = run.Bundle.Draft.Id
+	return nil
+}
+
+func runFilesStep(ctx context.Context, run *PipelineRun) error {
+	for _, file := range run.Bundle.Files {
+		if run.State.attached(run.State.Files, file.Name, file.Type) {
+			logger.Info("File already attached, skipping", "file", file.Name)
+			continue
+		}
+		directory, name := run.Bundle.Directory, file.Name
+		if file.Source != "" {
+			directory, name = filepath.Split(file.Source)
+		}
+		fileId, err := run.upload(ctx, directory, name)
+		if err != nil {
+			return fmt.Errorf("Error uploading file: %s", err)
+		}
+		file.FileId = fileId
+
+		if err := run.Bundle.Draft.addFile(ctx, file, run.Client); err != nil {
+			return fmt.Errorf("Error adding file: %s", err)
+		}
+		run.State.addFile(file)
+	}
+	return nil
+}
+
+func preparePreviewsStep(ctx context.Context, run *PipelineRun) error {
+	if err := checkPreviews(run.Bundle); err != nil {
+		return err
+	}
+	if err := prepareThumbnails(run.Bundle, run.TempDir, thumbnailRulesFor(run.Settings)); err != nil {
+		return err
+	}
+	return prepareTurntables(run.Bundle, run.TempDir, run.Settings)
+}
+
+func runPreviewsStep(ctx context.Context, run *PipelineRun) error {
+	job := previewJob{
+		Client:    run.Client,
+		Draft:     &run.Bundle.Draft,
+		Directory: run.Bundle.Directory,
+		Upload: func(ctx context.Context, path string) (int, error) {
+			directory, name := filepath.Split(path)
+			return run.upload(ctx, directory, name)
+		},
+	}
+	for _, preview := range run.Bundle.Previews {
+		if run.State.attached(run.State.Previews, preview.Name, preview.Type) {
+			logger.Info("Preview already attached, skipping", "preview", preview.Name)
+			continue
+		}
+		// Prepare normally rejects unknown types in checkPreviews.
+		handler, ok := previewHandlers[preview.Type]
+		if !ok {
+			return fmt.Errorf("%s: unknown preview type %q, expected one of %s", preview.Name, preview.Type, previewTypes())
+		}
+		if err := handler(ctx, job, &preview); err != nil {
+			return err
+		}
+		run.State.addPreview(preview)
+	}
+	return nil
+}
+
+// stepNames lists the names of the steps, for flag help and errors.
+func stepNames(steps []Step) string {
+	var names []string
+	for _, step := range steps {
+		names = append(names, step.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// stepList collects step names from repeated or comma-separated flags.
+type stepList []string
+
+func (list *stepList) String() string {
+	return strings.Join(*list, ",")
+}
+
+func (list *stepList) Set(value string) error {
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			*list = append(*list, name)
+		}
+	}
+	return nil
+}
+
+// stepKey identifies a step's inputs by hashing them.
+func stepKey(step *Step, run *PipelineRun) (string, error) {
+	data, err := json.Marshal(step.Key(run))
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return step.Name + ":" + hex.EncodeToString(sum[:])[:12], nil
+}
+
+// Plan decides which steps the run will go through, applying -only, -skip,
+// -publish and -draft, and skipping steps a resumed run already finished.
+func (pipeline *Pipeline) Plan(run *PipelineRun) ([]PlannedStep, error) {
+	var unknown []string
+	for _, name := range append(append([]string{}, run.Params.Only...), run.Params.Skip...) {
+		if pipeline.step(name) == nil {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("unknown step %s, expected one of %s", strings.Join(unknown, ", "), stepNames(pipeline.Steps))
+	}
+
+	var plan []PlannedStep
+	for i := range pipeline.Steps {
+		step := &pipeline.Steps[i]
+		key, err := stepKey(step, run)
+		if err != nil {
+			return nil, err
+		}
+		planned := PlannedStep{Step: step, Key: key}
+		switch {
+		case len(run.Params.Only) > 0 && !containsString(run.Params.Only, step.Name):
+			planned.Skip = "not in -only"
+		case containsString(run.Params.Skip, step.Name):
+			planned.Skip = "in -skip"
+		case step.Name == "draft" && run.Params.DraftId > 0:
+			planned.Skip = fmt.Sprintf("using draft %d", run.Params.DraftId)
+		case step.Name == "publish" && !run.Params.Publish:
+			planned.Skip = "-publish not set"
+		case containsString(run.State.Steps, key):
+			planned.Skip = "already done"
+		}
+		plan = append(plan, planned)
+	}
+
+	creates := false
+	for _, planned := range plan {
+		if planned.Step.Name == "draft" && planned.Skip == "" {
+			creates = true
+		}
+		if planned.Step.NeedsDraft && planned.Skip == "" && !creates && run.Params.DraftId == 0 {
+			return nil, fmt.Errorf("step %s needs a draft, run the draft step or give one with -draft", planned.Step.Name)
+		}
+	}
+	return plan, nil
+}
+
+func (pipeline *Pipeline) step(name string) *Step {
+	for i := range pipeline.Steps {
+		if pipeline.Steps[i].Name == name {
+			return &pipeline.Steps[i]
+		}
+	}
+	return nil
+}
+
+// Run prepares every planned step, then runs them in order. A step's Before
+// hooks run just ahead of its Run, so they see the draft once it exists.
+func (pipeline *Pipeline) Run(ctx context.Context, run *PipelineRun, plan []PlannedStep) error {
+	for _, planned := range plan {
+		step := planned.Step
+		if planned.Skip != "" {
+			continue
+		}
+		if step.Prepare != nil {
+			if err := step.Prepare(ctx, run); err != nil {
+				return err
+			}
+		}
+	}
+	for _, planned := range plan {
+		step := planned.Step
+		if planned.Skip != "" {
+			logger.Debug("Skipping step", "step", step.Name, "reason", planned.Skip)
+			continue
+		}
+		for _, hook := range pipeline.Before {
+			if err := hook(ctx, step, run); err != nil {
+				return fmt.Errorf("before %s: %s", step.Name, err)
+			}
+		}
+		logger.Debug("Running step", "step", step.Name, "key", planned.Key)
+		if err := step.Run(ctx, run); err != nil {
+			return err
+		}
+		run.State.Steps = append(run.State.Steps, planned.Key)
+		for _, hook := range pipeline.After {
+			if err := hook(ctx, step, run); err != nil {
+				return fmt.Errorf("after %s: %s", step.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// printPlan lists the steps without running them.
+func printPlan(plan []PlannedStep) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "STEP\tACTION\tINPUTS\tOUTPUTS\tKEY\n")
+	for _, planned := range plan {
+		action := "run"
+		if planned.Skip != "" {
+			action = "skip (" + planned.Skip + ")"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", planned.Step.Name, action,
+			strings.Join(planned.Step.Inputs, ", "), strings.Join(planned.Step.Outputs, ", "), planned.Key)
+	}
+	w.Flush()
+}
+
+// commandHooks turns the hooks setting, which maps before_<step> and
+// after_<step> to shell commands, into step hooks. Commands run in the
+// product folder with the step, draft and product IDs in the environment.
+func commandHooks(pipeline *Pipeline, commands map[string]string) error {
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		name, command := name, commands[name]
+		var when, stepName string
+		if strings.HasPrefix(name, "before_") {
+			when, stepName = "before", strings.TrimPrefix(name, "before_")
+		} else if strings.HasPrefix(name, "after_") {
+			when, stepName = "after", strings.TrimPrefix(name, "after_")
+		}
+		if when == "" || pipeline.step(stepName) == nil {
+			return fmt.Errorf("invalid hook %q, expected before_<step> or after_<step> with a step of %s", name, stepNames(pipeline.Steps))
+		}
+		hook := func(ctx context.Context, step *Step, run *PipelineRun) error {
+			if step.Name != stepName {
+				return nil
+			}
+			logger.Info("Running hook", "hook", name, "command", command)
+			cmd := exec.CommandContext(ctx, "sh", "-c", command)
+			cmd.Dir = run.Bundle.Directory
+			cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+			cmd.Env = append(os.Environ(),
+				"TS_STEP="+step.Name,
+				"TS_PRODUCT_DIR="+run.Bundle.Directory,
+				"TS_DRAFT_ID="+strconv.Itoa(run.Bundle.Draft.Id),
+				"TS_PRODUCT_ID="+strconv.Itoa(run.State.ProductId),
+			)
+			return cmd.Run()
+		}
+		if when == "before" {
+			pipeline.Before = append(pipeline.Before, hook)
+		} else {
+			pipeline.After = append(pipeline.After, hook)
+		}
+	}
+	return nil
+}
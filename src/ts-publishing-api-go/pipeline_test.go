@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/turbosquid/ts-publishing-api-go/mockapi"
+)
+
+// testProduct writes a product folder with one OBJ file and one thumbnail.
+func testProduct(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "ts-publishing-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	product := `{
+		"product": {"name": "Test Cube", "price_usd": "19.99", "tags": ["Cube", "box"]},
+		"files": [{"file_name": "cube.obj", "type": "product_file", "is_native": true}],
+		"previews": [{"file_name": "thumbnail.png", "type": "thumbnail"}]
+	}`
+	var thumbnail bytes.Buffer
+	if err = png.Encode(&thumbnail, image.NewRGBA(image.Rect(0, 0, 1200, 900))); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{
+		"product.json":  []byte(product),
+		"cube.obj":      []byte("v 0 0 0\nv 1 0 0\nv 1 1 0\nv 0 1 0\nf 1 2 3 4\n"),
+		"thumbnail.png": thumbnail.Bytes(),
+	}
+	for name, data := range files {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestPublishAgainstMockAPI(t *testing.T) {
+	api := mockapi.NewServer(mockapi.Options{
+		Token:         "secret",
+		UploadStates:  []string{"success"},
+		RequireObject: true,
+	})
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	dir := testProduct(t)
+	defer os.RemoveAll(dir)
+	defer func(saved *Logger) { logger = saved }(logger)
+	logger, _ = NewLogger(ioutil.Discard, LevelInfo, "text")
+
+	settings := Settings{Token: "secret", Server: server.URL, S3Endpoint: server.URL + "/s3"}
+	settings.applyDefaults()
+	params := Params{Path: dir, Publish: true}
+	productBundle := ReadInput(dir, nil)
+	state := NewRunState(dir)
+	if err := run(context.Background(), NewClient(settings), settings, params, &productBundle, state); err != nil {
+		t.Fatalf("run returned %s", err)
+	}
+
+	if state.DraftId == 0 || state.ProductId == 0 {
+		t.Fatalf("run finished with draft %d and product %d", state.DraftId, state.ProductId)
+	}
+	if len(state.Steps) != len(publishSteps) {
+		t.Errorf("run finished %d steps, want %d", len(state.Steps), len(publishSteps))
+	}
+	draft, attachments := api.Draft(strconv.Itoa(state.DraftId))
+	if draft == nil {
+		t.Fatalf("draft %d was not stored", state.DraftId)
+	}
+	if name := draft.Attributes["name"]; name != "Test Cube" {
+		t.Errorf("draft name = %v, want Test Cube", name)
+	}
+	types := map[string]int{}
+	for _, attachment := range attachments {
+		types[attachment.Type]++
+	}
+	if types["product_file"] != 1 || types["thumbnail"] != 1 {
+		t.Errorf("draft attachments = %v, want one product_file and one thumbnail", types)
+	}
+
+	var uploaded [][]byte
+	for _, request := range api.Requests() {
+		if strings.HasPrefix(request, "PUT /s3/mock-bucket/") {
+			data, ok := api.Object("mock-bucket", strings.TrimPrefix(request, "PUT /s3/mock-bucket/"))
+			if !ok {
+				t.Errorf("%s was not stored", request)
+			}
+			uploaded = append(uploaded, data)
+		}
+	}
+	if len(uploaded) != 2 {
+		t.Fatalf("%d objects were uploaded, want 2", len(uploaded))
+	}
+	model, _ := ioutil.ReadFile(filepath.Join(dir, "cube.obj"))
+	if !bytes.Equal(uploaded[0], model) {
+		t.Errorf("uploaded product file is %q, want %q", uploaded[0], model)
+	}
+}
+
+func TestPlan(t *testing.T) {
+	pipeline := Pipeline{Steps: publishSteps}
+	productBundle := NewProductBundle("")
+	keyOf := func(name string) string {
+		key, err := stepKey(pipeline.step(name), &PipelineRun{Bundle: &productBundle})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+
+	tests := []struct {
+		name   string
+		params Params
+		done   []string
+		// skips maps each skipped step to its reason; other steps run.
+		skips map[string]string
+		err   string
+	}{
+		{
+			name:  "default",
+			skips: map[string]string{"publish": "-publish not set"},
+		},
+		{
+			name:   "publish",
+			params: Params{Publish: true},
+			skips:  map[string]string{},
+		},
+		{
+			name:   "only",
+			params: Params{Only: []string{"draft", "files"}},
+			skips:  map[string]string{"previews": "not in -only", "certifications": "not in -only", "publish": "not in -only"},
+		},
+		{
+			name:   "skip",
+			params: Params{Skip: []string{"certifications"}, Publish: true},
+			skips:  map[string]string{"certifications": "in -skip"},
+		},
+		{
+			name:   "draft",
+			params: Params{DraftId: 7, Only: []string{"previews"}},
+			skips:  map[string]string{"draft": "not in -only", "files": "not in -only", "certifications": "not in -only", "publish": "not in -only"},
+		},
+		{
+			name:   "draft skips the draft step",
+			params: Params{DraftId: 7},
+			skips:  map[string]string{"draft": "using draft 7", "publish": "-publish not set"},
+		},
+		{
+			name:   "resume skips finished steps",
+			params: Params{DraftId: 7, Publish: true},
+			done:   []string{keyOf("files"), keyOf("previews")},
+			skips:  map[string]string{"draft": "using draft 7", "files": "already done", "previews": "already done"},
+		},
+		{
+			name:   "steps after draft need a draft",
+			params: Params{Only: []string{"files"}},
+			err:    "step files needs a draft",
+		},
+		{
+			name:   "skipping draft needs a draft",
+			params: Params{Skip: []string{"draft"}},
+			err:    "step files needs a draft",
+		},
+		{
+			name:   "unknown step",
+			params: Params{Only: []string{"draft", "upload"}, Skip: []string{"tags"}},
+			err:    "unknown step upload, tags",
+		},
+	}
+	for _, test := range tests {
+		state := NewRunState("")
+		state.Steps = test.done
+		plan, err := pipeline.Plan(&PipelineRun{Params: test.params, Bundle: &productBundle, State: state})
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: Plan returned %v, want an error containing %q", test.name, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: Plan returned %s", test.name, err)
+			continue
+		}
+		if len(plan) != len(publishSteps) {
+			t.Errorf("%s: plan has %d steps, want %d", test.name, len(plan), len(publishSteps))
+		}
+		for _, planned := range plan {
+			if planned.Skip != test.skips[planned.Step.Name] {
+				t.Errorf("%s: step %s skip = %q, want %q", test.name, planned.Step.Name, planned.Skip, test.skips[planned.Step.Name])
+			}
+			if planned.Key != keyOf(planned.Step.Name) {
+				t.Errorf("%s: step %s key = %s, want %s", test.name, planned.Step.Name, planned.Key, keyOf(planned.Step.Name))
+			}
+		}
+	}
+}
+
+// TestPipelineHooks runs a pipeline of stand-in steps with shell hooks that
+// log the step and TS_DRAFT_ID they see.
+func TestPipelineHooks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ts-publishing-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(saved *Logger) { logger = saved }(logger)
+	logger, _ = NewLogger(ioutil.Discard, LevelInfo, "text")
+
+	logPath := filepath.Join(dir, "hooks.log")
+	record := func(line string) {
+		f, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.WriteString(line + "\n")
+		f.Close()
+	}
+	step := func(name string) Step {
+		return Step{
+			Name:       name,
+			NeedsDraft: name != "draft",
+			Key:        func(run *PipelineRun) interface{} { return name },
+			Prepare: func(ctx context.Context, run *PipelineRun) error {
+				record("prepare " + name)
+				return nil
+			},
+			Run: func(ctx context.Context, run *PipelineRun) error {
+				record("run " + name)
+				if name == "draft" {
+					run.Bundle.Draft.Id = 42
+				}
+				return nil
+			},
+		}
+	}
+	hooks := map[string]string{
+		"before_draft": `echo "before $TS_STEP $TS_DRAFT_ID" >> hooks.log`,
+		"after_draft":  `echo "after $TS_STEP $TS_DRAFT_ID" >> hooks.log`,
+		"before_files": `echo "before $TS_STEP $TS_DRAFT_ID" >> hooks.log`,
+		"after_files":  `echo "after $TS_STEP $TS_DRAFT_ID" >> hooks.log`,
+	}
+
+	tests := []struct {
+		name  string
+		fail  bool
+		lines []string
+	}{
+		{
+			name: "before hooks run just ahead of their step",
+			lines: []string{
+				"prepare draft", "prepare files",
+				"before draft 0", "run draft", "after draft 42",
+				"before files 42", "run files", "after files 42",
+			},
+		},
+		{
+			name: "a failing before hook stops the run",
+			fail: true,
+			lines: []string{
+				"prepare draft", "prepare files",
+				"before draft 0", "run draft", "after draft 42",
+				"before files 42",
+			},
+		},
+	}
+	for _, test := range tests {
+		os.Remove(logPath)
+		commands := map[string]string{}
+		for name, command := range hooks {
+			commands[name] = command
+		}
+		if test.fail {
+			commands["before_files"] += " && exit 3"
+		}
+		pipeline := Pipeline{Steps: []Step{step("draft"), step("files")}}
+		if err := commandHooks(&pipeline, commands); err != nil {
+			t.Fatal(err)
+		}
+		productBundle := NewProductBundle(dir)
+		run := &PipelineRun{Bundle: &productBundle, State: NewRunState(dir)}
+		plan, err := pipeline.Plan(run)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = pipeline.Run(context.Background(), run, plan)
+		if test.fail {
+			if err == nil || !strings.Contains(err.Error(), "before files") {
+				t.Errorf("%s: Run returned %v, want the before_files failure", test.name, err)
+			}
+			if len(run.State.Steps) != 1 {
+				t.Errorf("%s: %d steps finished, want 1", test.name, len(run.State.Steps))
+			}
+		} else if err != nil {
+			t.Errorf("%s: Run returned %s", test.name, err)
+		}
+		data, _ := ioutil.ReadFile(logPath)
+		if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); strings.Join(lines, "; ") != strings.Join(test.lines, "; ") {
+			t.Errorf("%s: hooks and steps ran as %q, want %q", test.name, lines, test.lines)
+		}
+	}
+}
+
+// TestRunPlan checks that -plan prints the plan without running any step or
+// hook, so it needs no API.
+func TestRunPlan(t *testing.T) {
+	dir := testProduct(t)
+	defer os.RemoveAll(dir)
+	defer func(saved *Logger) { logger = saved }(logger)
+	logger, _ = NewLogger(ioutil.Discard, LevelInfo, "text")
+
+	settings := Settings{
+		Token:  "secret",
+		Server: "http://127.0.0.1:1",
+		Hooks:  map[string]string{"before_draft": "touch hook-ran"},
+	}
+	settings.applyDefaults()
+	productBundle := ReadInput(dir, nil)
+	state := NewRunState(dir)
+	params := Params{Path: dir, Plan: true, Publish: true}
+	if err := run(context.Background(), NewClient(settings), settings, params, &productBundle, state); err != nil {
+		t.Fatalf("run returned %s", err)
+	}
+	if state.DraftId != 0 || len(state.Steps) != 0 {
+		t.Errorf("-plan ran steps: draft %d, steps %v", state.DraftId, state.Steps)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "hook-ran")); err == nil {
+		t.Errorf("-plan ran the before_draft hook")
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// previewJob is what a preview handler needs to attach a preview to a draft.
+type previewJob struct {
+	Client    *Client
+	Draft     *Draft
+	Directory string
+	// Upload uploads a file and returns its file ID.
+	Upload func(ctx context.Context, path string) (int, error)
+}
+
+// PreviewHandler uploads a preview's files and attaches it to the draft.
+type PreviewHandler func(ctx context.Context, job previewJob, preview *Preview) error
+
+// previewHandlers maps each product.json preview type to its handler.
+var previewHandlers = map[string]PreviewHandler{
+	"thumbnail": attachThumbnail,
+	"wireframe": attachThumbnail,
+	"turntable": attachTurntable,
+	"marmoset":  attachViewer("marmoset"),
+	"viewer360": attachViewer("360"),
+	"video":     attachVideo,
+}
+
+// videoExtensions are the video files TurboSquid accepts as previews.
+var videoExtensions = []string{".mp4", ".mov", ".webm"}
+
+// checkPreviews reports previews with an unknown type or an unsupported
+// file before anything is uploaded.
+func checkPreviews(productBundle *ProductBundle) error {
+	var problems []string
+	for _, preview := range productBundle.Previews {
+		if _, ok := previewHandlers[preview.Type]; !ok {
+			problems = append(problems, fmt.Sprintf("%s: unknown preview type %q, expected one of %s", preview.Name, preview.Type, previewTypes()))
+			continue
+		}
+		if preview.Type == "video" && !containsString(videoExtensions, strings.ToLower(filepath.Ext(preview.Name))) {
+			problems = append(problems, fmt.Sprintf("%s: videos must be one of %s", preview.Name, strings.Join(videoExtensions, ", ")))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("previews are not valid:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+func previewTypes() string {
+	var types []string
+	for previewType := range previewHandlers {
+		types = append(types, previewType)
+	}
+	sort.Strings(types)
+	return strings.Join(types, ", ")
+}
+
+// previewPath is the file to upload for a single-file preview.
+func previewPath(directory string, preview *Preview) string {
+	if preview.Source != "" {
+		return preview.Source
+	}
+	return filepath.Join(directory, preview.Name)
+}
+
+func attachThumbnail(ctx context.Context, job previewJob, preview *Preview) error {
+	fileId, err := job.Upload(ctx, previewPath(job.Directory, preview))
+	if err != nil {
+		return fmt.Errorf("Error uploading preview: %s", err)
+	}
+	preview.FileId = fileId
+	if preview.Type == "wireframe" && preview.ThumbnailType == "" {
+		preview.ThumbnailType = "wireframe"
+	}
+	if err := job.Draft.addThumbnail(ctx, *preview, job.Client); err != nil {
+		return fmt.Errorf("Error adding preview: %s", err)
+	}
+	return nil
+}
+
+func attachTurntable(ctx context.Context, job previewJob, preview *Preview) error {
+	for _, frame := range preview.FramePaths {
+		fileId, err := job.Upload(ctx, frame)
+		if err != nil {
+			return fmt.Errorf("Error uploading turntable file: %s", err)
+		}
+		preview.FileIds = append(preview.FileIds, fileId)
+	}
+	if err := job.Draft.addTurntable(ctx, *preview, job.Client); err != nil {
+		return fmt.Errorf("Error adding turntable: %s", err)
+	}
+	return nil
+}
+
+// attachViewer attaches an interactive viewer scene, such as a Marmoset
+// .mview file, as a viewer file of the given kind.
+func attachViewer(kind string) PreviewHandler {
+	return func(ctx context.Context, job previewJob, preview *Preview) error {
+		fileId, err := job.Upload(ctx, previewPath(job.Directory, preview))
+		if err != nil {
+			return fmt.Errorf("Error uploading viewer file: %s", err)
+		}
+		preview.FileId = fileId
+		if err := job.Draft.addViewer(ctx, *preview, kind, job.Client); err != nil {
+			return fmt.Errorf("Error adding viewer: %s", err)
+		}
+		return nil
+	}
+}
+
+func attachVideo(ctx context.Context, job previewJob, preview *Preview) error {
+	fileId, err := job.Upload(ctx, previewPath(job.Directory, preview))
+	if err != nil {
+		return fmt.Errorf("Error uploading video: %s", err)
+	}
+	preview.FileId = fileId
+	if err := job.Draft.addVideo(ctx, *preview, job.Client); err != nil {
+		return fmt.Errorf("Error adding video: %s", err)
+	}
+	return nil
+}
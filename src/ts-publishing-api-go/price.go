@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// usdDenominator is the number of minor units in a US dollar.
+	usdDenominator = 100
+	// minimumPrice and maximumPrice bound a paid product, in cents. A price
+	// of zero publishes the product as free.
+	minimumPrice = 100
+	maximumPrice = 99999900
+)
+
+// allowedCurrencies maps each currency TurboSquid accepts to its denominator.
+var allowedCurrencies = map[string]int{
+	"USD": usdDenominator,
+}
+
+// PricePoints are the prices TurboSquid accepts from Min to Max, in cents:
+// Min and every Step above it.
+type PricePoints struct {
+	Min  int `yaml:"min_cents"`
+	Max  int `yaml:"max_cents"`
+	Step int `yaml:"step_cents"`
+}
+
+// defaultPricePoints are used unless settings.yml sets price_points. Any
+// cent is accepted below $100; above that prices go up in whole dollars,
+// then in tens and hundreds of dollars.
+var defaultPricePoints = []PricePoints{
+	{Min: 100, Max: 9999, Step: 1},
+	{Min: 10000, Max: 99900, Step: 100},
+	{Min: 100000, Max: 999000, Step: 1000},
+	{Min: 1000000, Max: maximumPrice, Step: 10000},
+}
+
+type Price struct {
+	Value       int    `json:"value"`
+	Currency    string `json:"currency"`
+	Denominator int    `json:"denominator"`
+}
+
+// DecimalPrice is a price in US dollars read from product.json without going
+// through a float, so "19.99" and 19.99 are both exactly 1999 cents.
+type DecimalPrice struct {
+	Cents int
+	Set   bool
+}
+
+func (price *DecimalPrice) UnmarshalJSON(data []byte) error {
+	text := strings.TrimSpace(string(data))
+	if text == "null" {
+		*price = DecimalPrice{}
+		return nil
+	}
+	if strings.HasPrefix(text, `"`) {
+		if err := json.Unmarshal(data, &text); err != nil {
+			return err
+		}
+	}
+	cents, err := parseCents(text)
+	if err != nil {
+		return err
+	}
+	*price = DecimalPrice{Cents: cents, Set: true}
+	return nil
+}
+
+func (price DecimalPrice) MarshalJSON() ([]byte, error) {
+	if !price.Set {
+		return []byte("null"), nil
+	}
+	return []byte(formatCents(price.Cents)), nil
+}
+
+// parseCents converts a decimal dollar amount such as "19.99", "$20" or
+// "1,250.50" into cents. More than two decimal places are rejected unless
+// the extra digits are zeros.
+func parseCents(text string) (int, error) {
+	amount := strings.Replace(strings.TrimPrefix(strings.TrimSpace(text), "$"), ",", "", -1)
+	if amount == "" {
+		return 0, fmt.Errorf("empty price")
+	}
+	if strings.HasPrefix(amount, "-") {
+		return 0, fmt.Errorf("price %q is negative", text)
+	}
+	if strings.Count(amount, ".") > 1 {
+		return 0, fmt.Errorf("invalid price %q", text)
+	}
+	// strconv.Atoi would accept a sign on either part, e.g. "+5" or "5.-1".
+	if strings.ContainsAny(amount, "+-") {
+		return 0, fmt.Errorf("invalid price %q", text)
+	}
+
+	whole, fraction := amount, ""
+	if dot := strings.Index(amount, "."); dot >= 0 {
+		whole, fraction = amount[:dot], amount[dot+1:]
+	}
+	if whole == "" {
+		whole = "0"
+	}
+	if len(fraction) > 2 {
+		if strings.Trim(fraction[2:], "0") != "" {
+			return 0, fmt.Errorf("price %q has fractions of a cent", text)
+		}
+		fraction = fraction[:2]
+	}
+	for len(fraction) < 2 {
+		fraction += "0"
+	}
+
+	dollars, err := strconv.Atoi(whole)
+	if err != nil {
+		return 0, fmt.Errorf("invalid price %q", text)
+	}
+	cents, err := strconv.Atoi(fraction)
+	if err != nil {
+		return 0, fmt.Errorf("invalid price %q", text)
+	}
+	return dollars*usdDenominator + cents, nil
+}
+
+// price returns the draft's price, or a zero price when it has none.
+func (draft *Draft) price() Price {
+	if draft.Price == nil {
+		return Price{}
+	}
+	return *draft.Price
+}
+
+func formatCents(cents int) string {
+	return fmt.Sprintf("%d.%02d", cents/usdDenominator, cents%usdDenominator)
+}
+
+// resolvePrice builds the draft price from whichever of price_usd,
+// price_cents or an explicit price object was given, and validates it.
+func (draft *Draft) resolvePrice() error {
+	sources := 0
+	price := Price{Currency: "USD", Denominator: usdDenominator}
+	if draft.PriceUsd.Set {
+		sources++
+		price.Value = draft.PriceUsd.Cents
+	}
+	if draft.PriceCents != nil {
+		sources++
+		price.Value = *draft.PriceCents
+	}
+	if draft.Price != nil {
+		sources++
+		price = *draft.Price
+		if price.Currency == "" {
+			price.Currency = "USD"
+		}
+		price.Currency = strings.ToUpper(price.Currency)
+		if price.Denominator == 0 {
+			price.Denominator = allowedCurrencies[price.Currency]
+		}
+	}
+	if sources > 1 {
+		return fmt.Errorf("give only one of price_usd, price_cents and price")
+	}
+
+	if err := validatePrice(price); err != nil {
+		return err
+	}
+	draft.Price = &price
+	return nil
+}
+
+func validatePrice(price Price) error {
+	denominator, ok := allowedCurrencies[price.Currency]
+	if !ok {
+		return fmt.Errorf("currency %s is not accepted", price.Currency)
+	}
+	if price.Denominator != denominator {
+		return fmt.Errorf("%s prices must use a denominator of %d, got %d", price.Currency, denominator, price.Denominator)
+	}
+	if price.Value < 0 {
+		return fmt.Errorf("price %s is negative", formatCents(price.Value))
+	}
+	if price.Value > 0 && price.Value < minimumPrice {
+		return fmt.Errorf("price %s is below the minimum of %s", formatCents(price.Value), formatCents(minimumPrice))
+	}
+	if price.Value > maximumPrice {
+		return fmt.Errorf("price %s is above the maximum of %s", formatCents(price.Value), formatCents(maximumPrice))
+	}
+	return nil
+}
+
+// checkPricePoint reports a paid price that is not one of points.
+func checkPricePoint(price Price, points []PricePoints) error {
+	if price.Value == 0 {
+		return nil
+	}
+	for _, tier := range points {
+		if price.Value < tier.Min || price.Value > tier.Max {
+			continue
+		}
+		if tier.Step <= 1 || (price.Value-tier.Min)%tier.Step == 0 {
+			return nil
+		}
+		return fmt.Errorf("price %s is not a price point: prices from %s to %s go up in steps of %s",
+			formatCents(price.Value), formatCents(tier.Min), formatCents(tier.Max), formatCents(tier.Step))
+	}
+	return fmt.Errorf("price %s is not within any price point range", formatCents(price.Value))
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseCents(t *testing.T) {
+	tests := []struct {
+		text  string
+		cents int
+		err   bool
+	}{
+		{text: "19.99", cents: 1999},
+		{text: "$20", cents: 2000},
+		{text: " 1,250.50 ", cents: 125050},
+		{text: "5", cents: 500},
+		{text: ".5", cents: 50},
+		{text: "19.990", cents: 1999},
+		{text: "0", cents: 0},
+		{text: "", err: true},
+		{text: "-5", err: true},
+		{text: "+5", err: true},
+		{text: "5.-1", err: true},
+		{text: "19.999", err: true},
+		{text: "abc", err: true},
+		{text: "5.5.5", err: true},
+	}
+	for _, test := range tests {
+		cents, err := parseCents(test.text)
+		if test.err {
+			if err == nil {
+				t.Errorf("parseCents(%q) = %d, want an error", test.text, cents)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseCents(%q) returned %s", test.text, err)
+		} else if cents != test.cents {
+			t.Errorf("parseCents(%q) = %d, want %d", test.text, cents, test.cents)
+		}
+	}
+}
+
+func TestParseCentsMalformed(t *testing.T) {
+	_, err := parseCents("5.5.5")
+	if err == nil || !strings.Contains(err.Error(), "invalid price") {
+		t.Errorf("parseCents(\"5.5.5\") returned %v, want an invalid price error", err)
+	}
+}
+
+func TestCheckPricePoint(t *testing.T) {
+	custom := []PricePoints{{Min: 500, Max: 5000, Step: 500}}
+	tests := []struct {
+		cents  int
+		points []PricePoints
+		err    bool
+	}{
+		{cents: 0, points: defaultPricePoints},
+		{cents: 1999, points: defaultPricePoints},
+		{cents: 9999, points: defaultPricePoints},
+		{cents: 14900, points: defaultPricePoints},
+		{cents: 14950, points: defaultPricePoints, err: true},
+		{cents: 125000, points: defaultPricePoints},
+		{cents: 125500, points: defaultPricePoints, err: true},
+		{cents: 1250000, points: defaultPricePoints},
+		{cents: 1250100, points: defaultPricePoints, err: true},
+		{cents: 1000, points: custom},
+		{cents: 1999, points: custom, err: true},
+		{cents: 10000, points: custom, err: true},
+	}
+	for _, test := range tests {
+		err := checkPricePoint(Price{Value: test.cents, Currency: "USD", Denominator: usdDenominator}, test.points)
+		if test.err && err == nil {
+			t.Errorf("checkPricePoint(%s) accepted the price", formatCents(test.cents))
+		} else if !test.err && err != nil {
+			t.Errorf("checkPricePoint(%s) returned %s", formatCents(test.cents), err)
+		}
+	}
+}
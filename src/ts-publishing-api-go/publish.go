@@ -1,13 +1,8 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"fmt"
-	"io/ioutil"
-	"log"
-	"net/http"
-
-	"github.com/google/jsonapi"
 )
 
 type Thumbnail struct {
@@ -49,6 +44,10 @@ type ViewerFile struct {
 	FileId      int    `jsonapi:"attr,file_id"`
 	Description string `jsonapi:"attr,file_format"`
 }
+type Video struct {
+	Id     int `jsonapi:"primary,video"`
+	FileId int `jsonapi:"attr,file_id"`
+}
 type Certification struct {
 	Id   string `jsonapi:"primary,certification"`
 	Type string `jsonapi:"attr,certification_id"`
@@ -57,60 +56,33 @@ type Product struct {
 	Id    int    `jsonapi:"primary,product"`
 	Draft *Draft `jsonapi:"relation,draft"`
 }
+type ProductStatus struct {
+	Id     int    `jsonapi:"primary,product"`
+	Status string `jsonapi:"attr,status"`
+}
 
-func (draft *Draft) createDraft(settings Settings) error {
-	if settings.Debug {
-		log.Printf("Create Draft")
-	}
-	var message bytes.Buffer
-	if err := jsonapi.MarshalPayload(&message, draft); err != nil {
-		log.Fatal("Error building Create Draft message: ", err)
-		return err
-	}
-
-	url := fmt.Sprintf("%s/api/drafts", settings.Server)
-	req, err := http.NewRequest("POST", url, bytes.NewReader(message.Bytes()))
-	if err != nil {
-		log.Fatal("Error building request for Create Draft: ", err)
-		return err
+func (draft *Draft) createDraft(ctx context.Context, client *Client) error {
+	logger.Debug("Create draft")
+	// jsonapi cannot decode integer slices such as category_ids, so only
+	// the new ID is read back.
+	var created struct {
+		Id int `jsonapi:"primary,draft"`
 	}
-	req.Header.Add("Authorization", fmt.Sprintf("Token %s", settings.Token))
-	req.Header.Add("Accept", "application/vnd.api+json; com.turbosquid.api.version=1")
-	req.Header.Add("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Fatal("Error performing request for Create Draft: ", err)
+	if err := client.Request(ctx, "POST", "/api/drafts", draft, &created); err != nil {
 		return err
 	}
-
-	defer resp.Body.Close()
-
-	if settings.Debug {
-		buf := new(bytes.Buffer)
-		buf.ReadFrom(resp.Body)
-		bodyStr := buf.String()
-		resp.Body = ioutil.NopCloser(bytes.NewReader([]byte(bodyStr)))
-
-		log.Printf(resp.Status)
-		log.Printf(bodyStr)
-	}
-
-	err = jsonapi.UnmarshalPayload(resp.Body, draft)
+	draft.Id = created.Id
 	if draft.Id > 0 {
-		log.Printf("Draft ID %d", draft.Id)
+		logger.Info("Draft created", "draft_id", draft.Id)
 	}
-	return err
+	return nil
 }
 
-func (draft *Draft) addFile(file File, settings Settings) error {
-	if settings.Debug {
-		log.Printf("Adding file: %d", file.FileId)
-	}
-	var message bytes.Buffer
+func (draft *Draft) addFile(ctx context.Context, file File, client *Client) error {
+	logger.Debug("Adding file", "draft_id", draft.Id, "file", file.Name, "file_id", file.FileId, "type", file.Type)
+	var draftFile interface{}
 	if file.Type == "product_file" {
-		draftFile := &ProductFile{
+		draftFile = &ProductFile{
 			FileId:          file.FileId,
 			Format:          file.Format,
 			FormatVersion:   file.FormatVersion,
@@ -118,234 +90,145 @@ func (draft *Draft) addFile(file File, settings Settings) error {
 			RendererVersion: file.RendererVersion,
 			Native:          file.Native,
 		}
-		if err := jsonapi.MarshalPayload(&message, draftFile); err != nil {
-			log.Fatal("Error building product_file message: ", err)
-			return err
-		}
 	} else if file.Type == "customer_file" {
-		draftFile := &CustomerFile{
+		draftFile = &CustomerFile{
 			FileId:      file.FileId,
 			Description: file.Description,
 		}
-		if err := jsonapi.MarshalPayload(&message, draftFile); err != nil {
-			log.Fatal("Error building customer_file message: ", err)
-			return err
-		}
 	} else if file.Type == "promotional_file" {
-		draftFile := &PromotionalFile{
+		draftFile = &PromotionalFile{
 			FileId:      file.FileId,
 			Description: file.Description,
 		}
-		if err := jsonapi.MarshalPayload(&message, draftFile); err != nil {
-			log.Fatal("Error building promotional_file message: ", err)
-			return err
-		}
 	} else if file.Type == "texture_file" {
-		draftFile := &TextureFile{
+		draftFile = &TextureFile{
 			FileId:      file.FileId,
 			Description: file.Description,
 		}
-		if err := jsonapi.MarshalPayload(&message, draftFile); err != nil {
-			log.Fatal("Error building texture_file message: ", err)
-			return err
-		}
 	} else if file.Type == "viewer_file" {
-		draftFile := &ViewerFile{
+		draftFile = &ViewerFile{
 			FileId:      file.FileId,
 			Description: file.Description,
 		}
-		if err := jsonapi.MarshalPayload(&message, draftFile); err != nil {
-			log.Fatal("Error building viewer_file message: ", err)
-			return err
-		}
-	}
-
-	url := fmt.Sprintf("%s/api/drafts/%d/%ss", settings.Server, draft.Id, file.Type)
-	req, err := http.NewRequest("POST", url, bytes.NewReader(message.Bytes()))
-	if err != nil {
-		log.Fatal("Error building request for Add File: ", err)
-		return err
+	} else {
+		return fmt.Errorf("unknown file type %q for %s", file.Type, file.Name)
 	}
-	req.Header.Add("Authorization", fmt.Sprintf("Token %s", settings.Token))
-	req.Header.Add("Accept", "application/vnd.api+json; com.turbosquid.api.version=1")
-	req.Header.Add("Content-Type", "application/json")
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Fatal("Error performing request for Add File: ", err)
-		return err
-	}
-
-	if resp.StatusCode != 200 && resp.StatusCode != 201 && resp.StatusCode != 202 {
-		log.Fatal("Failed to add file")
+	path := fmt.Sprintf("/api/drafts/%d/%ss", draft.Id, file.Type)
+	if err := client.Request(ctx, "POST", path, draftFile, nil); err != nil {
+		return fmt.Errorf("failed to add file %s: %s", file.Name, err)
 	}
-
 	return nil
 }
 
-func (draft *Draft) addThumbnail(preview Preview, settings Settings) error {
-	if settings.Debug {
-		log.Printf("Adding preview: %s", preview.Name)
-	}
+func (draft *Draft) addThumbnail(ctx context.Context, preview Preview, client *Client) error {
+	logger.Debug("Adding preview", "draft_id", draft.Id, "preview", preview.Name, "file_id", preview.FileId)
 	thumbnail := &Thumbnail{
 		FileId: preview.FileId,
 		Type:   preview.ThumbnailType,
 	}
 
-	var message bytes.Buffer
-	if err := jsonapi.MarshalPayload(&message, thumbnail); err != nil {
-		log.Fatal("Error building thumbnail message: ", err)
-		return err
-	}
-
-	url := fmt.Sprintf("%s/api/drafts/%d/%ss", settings.Server, draft.Id, preview.Type)
-	req, err := http.NewRequest("POST", url, bytes.NewReader(message.Bytes()))
-	if err != nil {
-		log.Fatal("Error building request for thumbnail: ", err)
-		return err
-	}
-	req.Header.Add("Authorization", fmt.Sprintf("Token %s", settings.Token))
-	req.Header.Add("Accept", "application/vnd.api+json; com.turbosquid.api.version=1")
-	req.Header.Add("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Fatal("Error performing request for Add Thumbnail: ", err)
-		return err
-	}
-
-	if resp.StatusCode != 200 && resp.StatusCode != 201 && resp.StatusCode != 202 {
-		log.Fatal("Failed to add preview")
+	path := fmt.Sprintf("/api/drafts/%d/thumbnails", draft.Id)
+	if err := client.Request(ctx, "POST", path, thumbnail, nil); err != nil {
+		return fmt.Errorf("failed to add preview %s: %s", preview.Name, err)
 	}
-
 	return nil
 }
 
-func (draft *Draft) addTurntable(preview Preview, settings Settings) error {
-	if settings.Debug {
-		log.Printf("Adding turntable: %s", preview.Name)
-	}
+func (draft *Draft) addTurntable(ctx context.Context, preview Preview, client *Client) error {
+	logger.Debug("Adding turntable", "draft_id", draft.Id, "preview", preview.Name, "file_ids", preview.FileIds)
 	turntable := &Turntable{
 		FileIds: preview.FileIds,
 		Type:    preview.ThumbnailType,
 	}
 
-	var message bytes.Buffer
-	if err := jsonapi.MarshalPayload(&message, turntable); err != nil {
-		log.Fatal("Error building turntable message: ", err)
-		return err
+	path := fmt.Sprintf("/api/drafts/%d/%ss", draft.Id, preview.Type)
+	if err := client.Request(ctx, "POST", path, turntable, nil); err != nil {
+		return fmt.Errorf("failed to add turntable %s: %s", preview.Name, err)
 	}
+	return nil
+}
 
-	url := fmt.Sprintf("%s/api/drafts/%d/%ss", settings.Server, draft.Id, preview.Type)
-	req, err := http.NewRequest("POST", url, bytes.NewReader(message.Bytes()))
-	if err != nil {
-		log.Fatal("Error building request for turntable: ", err)
-		return err
+func (draft *Draft) addViewer(ctx context.Context, preview Preview, kind string, client *Client) error {
+	logger.Debug("Adding viewer", "draft_id", draft.Id, "preview", preview.Name, "file_id", preview.FileId, "viewer", kind)
+	viewer := &ViewerFile{
+		FileId:      preview.FileId,
+		Description: kind,
 	}
-	req.Header.Add("Authorization", fmt.Sprintf("Token %s", settings.Token))
-	req.Header.Add("Accept", "application/vnd.api+json; com.turbosquid.api.version=1")
-	req.Header.Add("Content-Type", "application/json")
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Fatal("Error performing request for Add Turntable: ", err)
-		return err
+	path := fmt.Sprintf("/api/drafts/%d/viewer_files", draft.Id)
+	if err := client.Request(ctx, "POST", path, viewer, nil); err != nil {
+		return fmt.Errorf("failed to add viewer %s: %s", preview.Name, err)
 	}
+	return nil
+}
 
-	if resp.StatusCode != 200 && resp.StatusCode != 201 && resp.StatusCode != 202 {
-		log.Fatal("Failed to add turntable")
+func (draft *Draft) addVideo(ctx context.Context, preview Preview, client *Client) error {
+	logger.Debug("Adding video", "draft_id", draft.Id, "preview", preview.Name, "file_id", preview.FileId)
+	video := &Video{
+		FileId: preview.FileId,
 	}
 
+	path := fmt.Sprintf("/api/drafts/%d/videos", draft.Id)
+	if err := client.Request(ctx, "POST", path, video, nil); err != nil {
+		return fmt.Errorf("failed to add video %s: %s", preview.Name, err)
+	}
 	return nil
 }
 
-func (draft *Draft) certifications(settings Settings, certifications []string) error {
-
+func (draft *Draft) certifications(ctx context.Context, client *Client, certifications []string) error {
+	path := fmt.Sprintf("/api/drafts/%d/certifications", draft.Id)
 	for _, certificationType := range certifications {
-		if settings.Debug {
-			log.Printf("Add certification: %s", certificationType)
-		}
-		url := fmt.Sprintf("%s/api/drafts/%d/certifications", settings.Server, draft.Id)
-
+		logger.Debug("Adding certification", "draft_id", draft.Id, "certification", certificationType)
 		certification := &Certification{
 			Type: certificationType,
 		}
-		var message bytes.Buffer
-		if err := jsonapi.MarshalPayload(&message, certification); err != nil {
-			log.Fatal("Error building certification message: ", err)
-			return err
-		}
-
-		req, err := http.NewRequest("POST", url, bytes.NewReader(message.Bytes()))
-		if err != nil {
-			log.Fatal("Error building request for certification: ", err)
-			return err
-		}
-		req.Header.Add("Authorization", fmt.Sprintf("Token %s", settings.Token))
-		req.Header.Add("Accept", "application/vnd.api+json; com.turbosquid.api.version=1")
-		req.Header.Add("Content-Type", "application/json")
-
-		client := &http.Client{}
-		resp, err := client.Do(req)
-		if err != nil {
-			log.Fatal("Error performing request for Certification: ", err)
-			return err
-		}
-
-		if resp.StatusCode != 200 && resp.StatusCode != 201 && resp.StatusCode != 202 {
-			log.Fatal("Failed to set certification")
+		if err := client.Request(ctx, "POST", path, certification, nil); err != nil {
+			return fmt.Errorf("failed to set certification %s: %s", certificationType, err)
 		}
 	}
 
 	return nil
 }
 
-func (draft *Draft) publish(settings Settings) (error, int) {
-	log.Printf("Publish draft")
-	url := fmt.Sprintf("%s/api/products", settings.Server)
-
+func (draft *Draft) publish(ctx context.Context, client *Client) (error, int) {
+	logger.Info("Publishing draft", "draft_id", draft.Id)
 	var product Product
 	product.Draft = draft
 
-	var message bytes.Buffer
-	if err := jsonapi.MarshalPayloadWithoutIncluded(&message, &product); err != nil {
-		log.Fatal("Error building product message: ", err)
-		return err, 0
-	}
-
-	req, err := http.NewRequest("POST", url, bytes.NewReader(message.Bytes()))
-	if err != nil {
-		log.Fatal("Error building request for publish: ", err)
-		return err, 0
-	}
-	req.Header.Add("Authorization", fmt.Sprintf("Token %s", settings.Token))
-	req.Header.Add("Accept", "application/vnd.api+json; com.turbosquid.api.version=1")
-	req.Header.Add("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Fatal("Error performing request for Publish: ", err)
+	if err := client.Request(ctx, "POST", "/api/products", &product, &product); err != nil {
 		return err, 0
 	}
+	return nil, product.Id
+}
 
-	defer resp.Body.Close()
+func (draft *Draft) delete(ctx context.Context, client *Client) error {
+	logger.Info("Deleting draft", "draft_id", draft.Id)
+	return client.Request(ctx, "DELETE", fmt.Sprintf("/api/drafts/%d", draft.Id), nil, nil)
+}
 
-	if settings.Debug {
-		buf := new(bytes.Buffer)
-		buf.ReadFrom(resp.Body)
-		bodyStr := buf.String()
-		resp.Body = ioutil.NopCloser(bytes.NewReader([]byte(bodyStr)))
+// Product status values, as listed for the product resource's status
+// attribute in the API documentation at https://docs.api.turbosquid.com.
+const (
+	productStatusOffline = "offline"
+	productStatusOnline  = "online"
+)
 
-		log.Printf(resp.Status)
-		log.Printf(bodyStr)
+// setProductStatus takes a product offline or lists it again. Offline
+// products stay on the account and keep their ID.
+func setProductStatus(ctx context.Context, client *Client, id int, status string) error {
+	logger.Info("Setting product status", "product_id", id, "status", status)
+	product := &ProductStatus{Id: id, Status: status}
+	if err := client.Request(ctx, "PATCH", fmt.Sprintf("/api/products/%d", id), product, nil); err != nil {
+		return fmt.Errorf("failed to set product %d %s: %s", id, status, err)
 	}
+	return nil
+}
 
-	if err = jsonapi.UnmarshalPayload(resp.Body, &product); err != nil {
-		return err, 0
-	}
-	return nil, product.Id
+func unpublishProduct(ctx context.Context, client *Client, id int) error {
+	return setProductStatus(ctx, client, id, productStatusOffline)
+}
+
+func relistProduct(ctx context.Context, client *Client, id int) error {
+	return setProductStatus(ctx, client, id, productStatusOnline)
 }
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// maxRecordedRequestBody is the largest request body kept in a recording.
+// Larger bodies, such as file uploads to S3, are only summarised by size and
+// hash.
+const maxRecordedRequestBody = 64 * 1024
+
+// RecordedBody holds a request or response body. Bodies that are not valid
+// UTF-8 are stored base64 encoded.
+type RecordedBody struct {
+	Size     int    `json:"size"`
+	SHA256   string `json:"sha256,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+	Text     string `json:"text,omitempty"`
+	Omitted  bool   `json:"omitted,omitempty"`
+}
+
+type RecordedRequest struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	Body    RecordedBody      `json:"body"`
+}
+
+type RecordedResponse struct {
+	StatusCode int               `json:"status_code"`
+	Status     string            `json:"status"`
+	Headers    map[string]string `json:"headers"`
+	Body       RecordedBody      `json:"body"`
+}
+
+// Exchange is one recorded API request and its response.
+type Exchange struct {
+	Sequence   int              `json:"sequence"`
+	StartedAt  time.Time        `json:"started_at"`
+	DurationMs int64            `json:"duration_ms"`
+	Request    RecordedRequest  `json:"request"`
+	Response   RecordedResponse `json:"response"`
+	Error      string           `json:"error,omitempty"`
+}
+
+func recordBody(body []byte, limit int) RecordedBody {
+	sum := sha256.Sum256(body)
+	recorded := RecordedBody{Size: len(body), SHA256: hex.EncodeToString(sum[:])}
+	if len(body) == 0 {
+		recorded.SHA256 = ""
+		return recorded
+	}
+	if limit > 0 && len(body) > limit {
+		recorded.Omitted = true
+		return recorded
+	}
+	body = RedactJSON(body)
+	if utf8.Valid(body) {
+		recorded.Text = string(body)
+	} else {
+		recorded.Encoding = "base64"
+		recorded.Text = base64.StdEncoding.EncodeToString(body)
+	}
+	return recorded
+}
+
+func (body RecordedBody) bytes() ([]byte, error) {
+	if body.Encoding == "base64" {
+		return base64.StdEncoding.DecodeString(body.Text)
+	}
+	return []byte(body.Text), nil
+}
+
+// RecordedSettingsFile is written to a recording with the settings the run
+// used, so a replay sends the same requests.
+const RecordedSettingsFile = "settings.json"
+
+// RecordedSettings are the settings that decide which URLs a run requests.
+// The API token is never saved.
+type RecordedSettings struct {
+	Server     string `json:"server"`
+	APIVersion int    `json:"api_version"`
+	Storage    string `json:"storage,omitempty"`
+	S3Endpoint string `json:"s3_endpoint,omitempty"`
+}
+
+// transportWrapper is implemented by transports that can be layered over
+// another transport, so the S3 client can keep its own *http.Transport.
+type transportWrapper interface {
+	Wrap(base http.RoundTripper) http.RoundTripper
+}
+
+// RecordingTransport saves every exchange passing through it as a numbered
+// JSON file in Dir. Secrets are redacted before anything is written.
+type RecordingTransport struct {
+	Dir  string
+	Base http.RoundTripper
+
+	mu       sync.Mutex
+	sequence int
+}
+
+func NewRecordingTransport(dir string, base http.RoundTripper) (*RecordingTransport, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &RecordingTransport{Dir: dir, Base: base}, nil
+}
+
+// SaveSettings writes RecordedSettingsFile to the recording.
+func (transport *RecordingTransport) SaveSettings(settings Settings) error {
+	data, err := json.MarshalIndent(RecordedSettings{
+		Server:     settings.Server,
+		APIVersion: settings.APIVersion,
+		Storage:    settings.Storage,
+		S3Endpoint: settings.S3Endpoint,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(transport.Dir, RecordedSettingsFile), data, 0644)
+}
+
+// Wrap returns a transport that records into the same recording but sends
+// requests through base.
+func (transport *RecordingTransport) Wrap(base http.RoundTripper) http.RoundTripper {
+	return roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return transport.roundTrip(req, base)
+	})
+}
+
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func (transport *RecordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return transport.roundTrip(req, transport.Base)
+}
+
+func (transport *RecordingTransport) roundTrip(req *http.Request, base http.RoundTripper) (*http.Response, error) {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	exchange := Exchange{
+		StartedAt: time.Now(),
+		Request: RecordedRequest{
+			Method:  req.Method,
+			URL:     req.URL.String(),
+			Headers: RedactHeaders(req.Header),
+		},
+	}
+	if req.Body != nil {
+		body, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		exchange.Request.Body = recordBody(body, maxRecordedRequestBody)
+	}
+
+	resp, err := base.RoundTrip(req)
+	exchange.DurationMs = int64(time.Since(exchange.StartedAt) / time.Millisecond)
+	if err != nil {
+		exchange.Error = err.Error()
+		transport.save(&exchange)
+		return nil, err
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	exchange.Response = RecordedResponse{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Headers:    RedactHeaders(resp.Header),
+		Body:       recordBody(body, 0),
+	}
+	transport.save(&exchange)
+	return resp, nil
+}
+
+func (transport *RecordingTransport) save(exchange *Exchange) {
+	transport.mu.Lock()
+	transport.sequence++
+	exchange.Sequence = transport.sequence
+	transport.mu.Unlock()
+
+	data, err := json.MarshalIndent(exchange, "", "  ")
+	if err != nil {
+		logger.Error("Unable to encode recorded exchange", "error", err)
+		return
+	}
+	name := fmt.Sprintf("%04d-%s.json", exchange.Sequence, exchange.Request.Method)
+	if err = ioutil.WriteFile(filepath.Join(transport.Dir, name), data, 0644); err != nil {
+		logger.Error("Unable to write recorded exchange", "file", name, "error", err)
+	}
+}
+
+// ReplayTransport answers requests from a recording instead of the network.
+// Each request is matched to the first unused exchange with the same method
+// and path, preferring one whose query string matches as well.
+type ReplayTransport struct {
+	// Settings are those the recording was made with, or nil for
+	// recordings that did not save them.
+	Settings *RecordedSettings
+
+	mu        sync.Mutex
+	exchanges []Exchange
+	used      []bool
+}
+
+func NewReplayTransport(dir string) (*ReplayTransport, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var exchanges []Exchange
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var exchange Exchange
+		if err = json.Unmarshal(data, &exchange); err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+		if exchange.Sequence == 0 {
+			continue
+		}
+		exchanges = append(exchanges, exchange)
+	}
+	if len(exchanges) == 0 {
+		return nil, fmt.Errorf("no recorded exchanges found in %s", dir)
+	}
+	sort.Slice(exchanges, func(i, j int) bool {
+		return exchanges[i].Sequence < exchanges[j].Sequence
+	})
+	transport := &ReplayTransport{exchanges: exchanges, used: make([]bool, len(exchanges))}
+	if data, err := ioutil.ReadFile(filepath.Join(dir, RecordedSettingsFile)); err == nil {
+		transport.Settings = &RecordedSettings{}
+		if err = json.Unmarshal(data, transport.Settings); err != nil {
+			return nil, fmt.Errorf("%s: %s", RecordedSettingsFile, err)
+		}
+	}
+	return transport, nil
+}
+
+// Wrap returns the replay transport itself, since a replay never reaches the
+// network.
+func (transport *ReplayTransport) Wrap(base http.RoundTripper) http.RoundTripper {
+	return transport
+}
+
+// Server returns the scheme and host of the first recorded API request.
+func (transport *ReplayTransport) Server() string {
+	for _, exchange := range transport.exchanges {
+		if strings.Contains(exchange.Request.URL, "/api/") {
+			return exchange.Request.URL[:strings.Index(exchange.Request.URL, "/api/")]
+		}
+	}
+	return ""
+}
+
+func (transport *ReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	transport.mu.Lock()
+	index := transport.match(req, true)
+	if index < 0 {
+		index = transport.match(req, false)
+	}
+	if index >= 0 {
+		transport.used[index] = true
+	}
+	transport.mu.Unlock()
+
+	if index < 0 {
+		return nil, fmt.Errorf("replay: no recorded response for %s %s", req.Method, req.URL)
+	}
+	exchange := transport.exchanges[index]
+	logger.Debug("Replaying exchange", "sequence", exchange.Sequence, "method", req.Method, "url", req.URL.String())
+	if exchange.Error != "" {
+		return nil, fmt.Errorf("replay: %s", exchange.Error)
+	}
+
+	body, err := exchange.Response.Body.bytes()
+	if err != nil {
+		return nil, err
+	}
+	header := http.Header{}
+	for name, value := range exchange.Response.Headers {
+		header.Set(name, value)
+	}
+	header.Set("Content-Length", fmt.Sprintf("%d", len(body)))
+	return &http.Response{
+		Status:        exchange.Response.Status,
+		StatusCode:    exchange.Response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+func (transport *ReplayTransport) match(req *http.Request, withQuery bool) int {
+	for i, exchange := range transport.exchanges {
+		if transport.used[i] || exchange.Request.Method != req.Method {
+			continue
+		}
+		recorded, err := req.URL.Parse(exchange.Request.URL)
+		if err != nil || recorded.Path != req.URL.Path {
+			continue
+		}
+		if withQuery && recorded.RawQuery != req.URL.RawQuery {
+			continue
+		}
+		return i
+	}
+	return -1
+}
@@ -0,0 +1,472 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// RemoteRecord is a draft or product read back from the API, with the files,
+// previews and certifications attached to it.
+type RemoteRecord struct {
+	Kind           string
+	Id             int
+	DraftId        int
+	Draft          Draft
+	CategoryIds    []int
+	Files          []File
+	Previews       []Preview
+	Certifications []string
+	// DownloadURLs maps file IDs to URLs the files can be fetched from, when
+	// the API provides them.
+	DownloadURLs map[int]string
+	// CreatedAt is zero when the API does not say when the record was made.
+	CreatedAt time.Time
+}
+
+// remoteAttachment holds the attachment attributes that File and Preview
+// do not carry under the same names.
+type remoteAttachment struct {
+	FileId          int      `json:"file_id"`
+	FileIds         []int    `json:"file_ids"`
+	FileName        string   `json:"file_name"`
+	DownloadURL     string   `json:"download_url"`
+	DownloadURLs    []string `json:"download_urls"`
+	ThumbnailType   string   `json:"thumbnail_type"`
+	CertificationId string   `json:"certification_id"`
+}
+
+var fileCollections = []string{"product_files", "customer_files", "promotional_files", "texture_files", "viewer_files"}
+
+// viewerKinds maps the file_format of viewer files created by previewHandlers
+// back to their preview types.
+var viewerKinds = map[string]string{"marmoset": "marmoset", "360": "viewer360"}
+
+// listRecords returns one page of the account's drafts or products.
+func listRecords(ctx context.Context, client *Client, kind string, page int, size int) ([]RemoteRecord, error) {
+	records, _, err := listRecordPage(ctx, client, kind, fmt.Sprintf("/api/%ss?page[number]=%d&page[size]=%d", kind, page, size))
+	return records, err
+}
+
+// listRecordPage reads the page of records at path and returns it with the
+// page that follows it.
+func listRecordPage(ctx context.Context, client *Client, kind string, path string) ([]RemoteRecord, ResourcePage, error) {
+	page, err := client.RequestPage(ctx, "GET", path)
+	if err != nil {
+		return nil, page, err
+	}
+	var records []RemoteRecord
+	for _, resource := range page.Resources {
+		record, err := newRemoteRecord(kind, resource)
+		if err != nil {
+			return nil, page, err
+		}
+		records = append(records, record)
+	}
+	return records, page, nil
+}
+
+func newRemoteRecord(kind string, resource Resource) (RemoteRecord, error) {
+	record := RemoteRecord{Kind: kind, DownloadURLs: map[int]string{}}
+	var err error
+	if record.Id, err = strconv.Atoi(resource.Id); err != nil {
+		return record, fmt.Errorf("%s has invalid id %q", kind, resource.Id)
+	}
+	if kind == "draft" {
+		record.DraftId = record.Id
+	} else if draftId := resource.Relationship("draft"); draftId != "" {
+		record.DraftId, _ = strconv.Atoi(draftId)
+	}
+	if len(resource.Attributes) > 0 {
+		if err = json.Unmarshal(resource.Attributes, &record.Draft); err != nil {
+			return record, fmt.Errorf("reading %s %d: %s", kind, record.Id, err)
+		}
+		var extra struct {
+			CategoryIds []int  `json:"category_ids"`
+			CreatedAt   string `json:"created_at"`
+		}
+		json.Unmarshal(resource.Attributes, &extra)
+		record.CategoryIds = extra.CategoryIds
+		record.CreatedAt, _ = time.Parse(time.RFC3339, extra.CreatedAt)
+	}
+	record.Draft.Id = record.DraftId
+	return record, nil
+}
+
+// listAllRecords reads every page of the account's drafts or products. It
+// follows the API's next links, or asks for page after page until one is
+// empty when there are none. A page that repeats a record means the API is
+// not paging as asked, and is an error rather than a silently short list.
+func listAllRecords(ctx context.Context, client *Client, kind string) ([]RemoteRecord, error) {
+	var all []RemoteRecord
+	seen := map[int]bool{}
+	path := fmt.Sprintf("/api/%ss?page[number]=1&page[size]=100", kind)
+	for number := 1; ; number++ {
+		records, page, err := listRecordPage(ctx, client, kind, path)
+		if err != nil {
+			return nil, err
+		}
+		if len(records) == 0 {
+			return all, nil
+		}
+		for _, record := range records {
+			if seen[record.Id] {
+				return nil, fmt.Errorf("page %d of %ss repeats %s %d, so not every %s can be listed", number, kind, kind, record.Id, kind)
+			}
+			seen[record.Id] = true
+		}
+		all = append(all, records...)
+		switch {
+		case page.Next != "":
+			path = page.Next
+		case page.Linked:
+			return all, nil
+		default:
+			path = fmt.Sprintf("/api/%ss?page[number]=%d&page[size]=100", kind, number+1)
+		}
+	}
+}
+
+// staleDrafts returns the drafts created before cutoff. Drafts that a product
+// was published from are never returned, and drafts without a creation time
+// are skipped with a warning.
+func staleDrafts(ctx context.Context, client *Client, cutoff time.Time) ([]RemoteRecord, error) {
+	drafts, err := listAllRecords(ctx, client, "draft")
+	if err != nil {
+		return nil, err
+	}
+	products, err := listAllRecords(ctx, client, "product")
+	if err != nil {
+		return nil, err
+	}
+	published := map[int]bool{}
+	for _, product := range products {
+		published[product.DraftId] = true
+	}
+	var stale []RemoteRecord
+	for _, draft := range drafts {
+		switch {
+		case published[draft.Id]:
+		case draft.CreatedAt.IsZero():
+			logger.Warn("Draft has no creation time, skipping", "draft_id", draft.Id)
+		case draft.CreatedAt.Before(cutoff):
+			stale = append(stale, draft)
+		}
+	}
+	return stale, nil
+}
+
+// deleteDrafts deletes each draft, carrying on past failures so one bad
+// draft does not stop a cleanup.
+func deleteDrafts(ctx context.Context, client *Client, ids []int) error {
+	var problems []string
+	for _, id := range ids {
+		draft := Draft{Id: id}
+		if err := draft.delete(ctx, client); err != nil {
+			problems = append(problems, fmt.Sprintf("draft %d: %s", id, err))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("some drafts were not deleted:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// confirm asks a yes/no question on in, defaulting to no.
+func confirm(in io.Reader, question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// fetchRecord reads one draft or product and everything attached to it.
+// Attachments are read from the draft a product was published from.
+func fetchRecord(ctx context.Context, client *Client, kind string, id int) (*RemoteRecord, error) {
+	resources, err := client.RequestResources(ctx, "GET", fmt.Sprintf("/api/%ss/%d", kind, id))
+	if err != nil {
+		return nil, err
+	}
+	if len(resources) != 1 {
+		return nil, fmt.Errorf("%s %d not found", kind, id)
+	}
+	record, err := newRemoteRecord(kind, resources[0])
+	if err != nil {
+		return nil, err
+	}
+	if record.DraftId == 0 {
+		return &record, nil
+	}
+
+	attachments := func(collection string) ([]Resource, error) {
+		return client.RequestResources(ctx, "GET", fmt.Sprintf("/api/drafts/%d/%s", record.DraftId, collection))
+	}
+	for _, collection := range fileCollections {
+		resources, err := attachments(collection)
+		if err != nil {
+			return nil, err
+		}
+		for _, resource := range resources {
+			var file File
+			var attachment remoteAttachment
+			json.Unmarshal(resource.Attributes, &file)
+			json.Unmarshal(resource.Attributes, &attachment)
+			file.FileId = attachment.FileId
+			file.Name = attachment.FileName
+			if file.Name == "" {
+				file.Name = fmt.Sprintf("file_%d", attachment.FileId)
+			}
+			if attachment.DownloadURL != "" {
+				record.DownloadURLs[attachment.FileId] = attachment.DownloadURL
+			}
+			if previewType, ok := viewerKinds[file.Format]; ok && collection == "viewer_files" {
+				record.Previews = append(record.Previews, Preview{FileId: file.FileId, Name: file.Name, Type: previewType})
+				continue
+			}
+			file.Type = strings.TrimSuffix(collection, "s")
+			if file.Type != "product_file" {
+				// Other file types send their description as file_format.
+				file.Description, file.Format = file.Format, ""
+			}
+			record.Files = append(record.Files, file)
+		}
+	}
+
+	for _, collection := range []string{"thumbnails", "turntables", "videos"} {
+		resources, err := attachments(collection)
+		if err != nil {
+			return nil, err
+		}
+		for _, resource := range resources {
+			var attachment remoteAttachment
+			json.Unmarshal(resource.Attributes, &attachment)
+			preview := Preview{
+				FileId:        attachment.FileId,
+				FileIds:       attachment.FileIds,
+				Name:          attachment.FileName,
+				Type:          strings.TrimSuffix(collection, "s"),
+				ThumbnailType: attachment.ThumbnailType,
+			}
+			if preview.Type == "thumbnail" && preview.ThumbnailType == "wireframe" {
+				preview.Type = "wireframe"
+			}
+			if preview.Name == "" {
+				preview.Name = fmt.Sprintf("%s_%s", preview.Type, resource.Id)
+			}
+			if attachment.DownloadURL != "" {
+				record.DownloadURLs[attachment.FileId] = attachment.DownloadURL
+			}
+			for i, url := range attachment.DownloadURLs {
+				if i < len(attachment.FileIds) {
+					record.DownloadURLs[attachment.FileIds[i]] = url
+				}
+			}
+			record.Previews = append(record.Previews, preview)
+		}
+	}
+
+	resources, err = attachments("certifications")
+	if err != nil {
+		return nil, err
+	}
+	for _, resource := range resources {
+		var attachment remoteAttachment
+		json.Unmarshal(resource.Attributes, &attachment)
+		if attachment.CertificationId != "" {
+			record.Certifications = append(record.Certifications, attachment.CertificationId)
+		}
+	}
+	return &record, nil
+}
+
+// Bundle converts the record into a ProductBundle that can be written as
+// product.json. File IDs are dropped since a new draft gets new ones.
+func (record *RemoteRecord) Bundle(directory string) ProductBundle {
+	bundle := NewProductBundle(directory)
+	bundle.Draft = record.Draft
+	bundle.Draft.Id = 0
+	if price := bundle.Draft.price(); price.Currency == "USD" || price.Currency == "" {
+		bundle.Draft.PriceUsd = DecimalPrice{Cents: price.Value, Set: price.Value > 0}
+		bundle.Draft.Price = nil
+	}
+	for _, id := range record.CategoryIds {
+		bundle.Categories = append(bundle.Categories, CategoryRef(strconv.Itoa(id)))
+	}
+	for _, file := range record.Files {
+		file.FileId = 0
+		bundle.Files = append(bundle.Files, file)
+	}
+	for _, preview := range record.Previews {
+		preview.FileId, preview.FileIds = 0, nil
+		bundle.Previews = append(bundle.Previews, preview)
+	}
+	bundle.Certifications = record.Certifications
+	return bundle
+}
+
+// print writes a human-readable summary of the record to stdout.
+func (record *RemoteRecord) print() {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "%s\t%d\n", strings.ToUpper(record.Kind[:1])+record.Kind[1:], record.Id)
+	if record.Kind == "product" && record.DraftId > 0 {
+		fmt.Fprintf(w, "Draft\t%d\n", record.DraftId)
+	}
+	fmt.Fprintf(w, "Name\t%s\n", record.Draft.Name)
+	fmt.Fprintf(w, "Status\t%s\n", record.Draft.Status)
+	if price := record.Draft.price(); price.Value > 0 {
+		fmt.Fprintf(w, "Price\t%s %s\n", formatCents(price.Value), price.Currency)
+	}
+	fmt.Fprintf(w, "License\t%s\n", record.Draft.License)
+	fmt.Fprintf(w, "Tags\t%s\n", strings.Join(record.Draft.Tags, ", "))
+	fmt.Fprintf(w, "Polygons\t%d\n", record.Draft.Polygons)
+	fmt.Fprintf(w, "Vertices\t%d\n", record.Draft.Vertices)
+	w.Flush()
+
+	fmt.Printf("\nFiles:\n")
+	for _, file := range record.Files {
+		fmt.Printf("  %d\t%s\t%s\t%s %s\n", file.FileId, file.Type, file.Name, file.Format, file.FormatVersion)
+	}
+	fmt.Printf("\nPreviews:\n")
+	for _, preview := range record.Previews {
+		if len(preview.FileIds) > 0 {
+			fmt.Printf("  %v\t%s\t%s\n", preview.FileIds, preview.Type, preview.Name)
+		} else {
+			fmt.Printf("  %d\t%s\t%s\n", preview.FileId, preview.Type, preview.Name)
+		}
+	}
+	fmt.Printf("\nCertifications:\n")
+	for _, certification := range record.Certifications {
+		fmt.Printf("  %s\n", certification)
+	}
+}
+
+// parseIds reads record IDs given on the command line.
+func parseIds(kind string, args []string) ([]int, error) {
+	var ids []int
+	for _, arg := range args {
+		id, err := strconv.Atoi(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s id %q", kind, arg)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// runRecords implements the drafts and products commands.
+func runRecords(command *Command, args []string) error {
+	kind := strings.TrimSuffix(command.Name, "s")
+	flags := newCommandFlags(command)
+	page := flags.Int("page", 1, "Page to list.")
+	size := flags.Int("size", 25, "Records per page.")
+	bundle := flags.Bool("bundle", false, "With show, print the record as product.json.")
+	var olderThan *int
+	var yes *bool
+	if kind == "draft" {
+		olderThan = flags.Int("older-than", 0, "With prune, delete drafts created more than this many days ago.")
+		yes = flags.Bool("yes", false, "With delete and prune, delete without asking for confirmation.")
+	}
+	flags.Parse(args)
+	// Flags may also follow the action, as in `drafts prune -older-than 30`.
+	action := flags.Arg(0)
+	if flags.NArg() > 0 {
+		flags.Parse(flags.Args()[1:])
+	}
+	actionArgs := flags.Args()
+
+	client := NewClient(GetSettings())
+	ctx := context.Background()
+	switch {
+	case action == "list" && len(actionArgs) == 0:
+		records, err := listRecords(ctx, client, kind, *page, *size)
+		if err != nil {
+			return err
+		}
+		if len(records) == 0 {
+			fmt.Printf("No %ss on page %d\n", kind, *page)
+			return nil
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintf(w, "ID\tSTATUS\tPRICE\tNAME\n")
+		for _, record := range records {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", record.Id, record.Draft.Status, formatCents(record.Draft.price().Value), record.Draft.Name)
+		}
+		return w.Flush()
+	case action == "show" && len(actionArgs) == 1:
+		id, err := strconv.Atoi(actionArgs[0])
+		if err != nil {
+			return fmt.Errorf("invalid %s id %q", kind, actionArgs[0])
+		}
+		record, err := fetchRecord(ctx, client, kind, id)
+		if err != nil {
+			return err
+		}
+		if !*bundle {
+			record.print()
+			return nil
+		}
+		output, err := json.MarshalIndent(record.Bundle(""), "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(output))
+		return nil
+	case kind == "draft" && action == "delete" && len(actionArgs) > 0:
+		ids, err := parseIds(kind, actionArgs)
+		if err != nil {
+			return err
+		}
+		if !*yes && !confirm(os.Stdin, fmt.Sprintf("Delete %d drafts (%s)?", len(ids), strings.Join(actionArgs, ", "))) {
+			fmt.Println("Nothing deleted")
+			return nil
+		}
+		return deleteDrafts(ctx, client, ids)
+	case kind == "draft" && action == "prune" && len(actionArgs) == 0 && *olderThan > 0:
+		cutoff := time.Now().AddDate(0, 0, -*olderThan)
+		drafts, err := staleDrafts(ctx, client, cutoff)
+		if err != nil {
+			return err
+		}
+		if len(drafts) == 0 {
+			fmt.Printf("No drafts older than %d days\n", *olderThan)
+			return nil
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintf(w, "ID\tCREATED\tNAME\n")
+		var ids []int
+		for _, draft := range drafts {
+			fmt.Fprintf(w, "%d\t%s\t%s\n", draft.Id, draft.CreatedAt.Format("2006-01-02"), draft.Draft.Name)
+			ids = append(ids, draft.Id)
+		}
+		w.Flush()
+		if !*yes && !confirm(os.Stdin, fmt.Sprintf("Delete %d drafts?", len(ids))) {
+			fmt.Println("Nothing deleted")
+			return nil
+		}
+		return deleteDrafts(ctx, client, ids)
+	case kind == "product" && (action == "unpublish" || action == "relist") && len(actionArgs) > 0:
+		ids, err := parseIds(kind, actionArgs)
+		if err != nil {
+			return err
+		}
+		change := unpublishProduct
+		if action == "relist" {
+			change = relistProduct
+		}
+		for _, id := range ids {
+			if err := change(ctx, client, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	flags.Usage()
+	return errUsage
+}
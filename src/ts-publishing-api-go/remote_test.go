@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/turbosquid/ts-publishing-api-go/mockapi"
+)
+
+func TestConfirm(t *testing.T) {
+	tests := []struct {
+		answer string
+		yes    bool
+	}{
+		{"y\n", true},
+		{"YES\n", true},
+		{" yes \n", true},
+		{"n\n", false},
+		{"\n", false},
+		{"", false},
+		{"yep\n", false},
+	}
+	for _, test := range tests {
+		if yes := confirm(strings.NewReader(test.answer), "Delete?"); yes != test.yes {
+			t.Errorf("confirm(%q) = %v, want %v", test.answer, yes, test.yes)
+		}
+	}
+}
+
+// mockClient starts a mock API and returns a client for it, silencing logs
+// until the returned function is called.
+func mockClient(t *testing.T) (*Client, func()) {
+	server := httptest.NewServer(mockapi.NewServer(mockapi.Options{Token: "secret"}))
+	saved := logger
+	logger, _ = NewLogger(ioutil.Discard, LevelInfo, "text")
+	settings := Settings{Token: "secret", Server: server.URL}
+	settings.applyDefaults()
+	return NewClient(settings), func() {
+		logger = saved
+		server.Close()
+	}
+}
+
+func createTestDrafts(t *testing.T, ctx context.Context, client *Client, names ...string) []int {
+	var ids []int
+	for _, name := range names {
+		draft := NewDraft()
+		draft.Name = name
+		if err := draft.createDraft(ctx, client); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, draft.Id)
+	}
+	return ids
+}
+
+func recordIds(t *testing.T, ctx context.Context, client *Client, kind string) []int {
+	records, err := listAllRecords(ctx, client, kind)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []int
+	for _, record := range records {
+		ids = append(ids, record.Id)
+	}
+	return ids
+}
+
+func TestDeleteDraftsAgainstMockAPI(t *testing.T) {
+	client, done := mockClient(t)
+	defer done()
+	ctx := context.Background()
+
+	ids := createTestDrafts(t, ctx, client, "One", "Two", "Three")
+	if err := deleteDrafts(ctx, client, ids[:2]); err != nil {
+		t.Fatalf("deleteDrafts returned %s", err)
+	}
+	if left := recordIds(t, ctx, client, "draft"); len(left) != 1 || left[0] != ids[2] {
+		t.Errorf("drafts left are %v, want [%d]", left, ids[2])
+	}
+
+	// A missing draft is reported without stopping the others.
+	err := deleteDrafts(ctx, client, []int{ids[0], ids[2]})
+	if err == nil || !strings.Contains(err.Error(), "draft "+strconv.Itoa(ids[0])) {
+		t.Errorf("deleting a missing draft returned %v", err)
+	}
+	if left := recordIds(t, ctx, client, "draft"); len(left) != 0 {
+		t.Errorf("drafts left are %v, want none", left)
+	}
+}
+
+func TestPruneDraftsAgainstMockAPI(t *testing.T) {
+	client, done := mockClient(t)
+	defer done()
+	ctx := context.Background()
+
+	ids := createTestDrafts(t, ctx, client, "Abandoned", "Published")
+	published := Draft{Id: ids[1]}
+	if err, _ := published.publish(ctx, client); err != nil {
+		t.Fatal(err)
+	}
+
+	stale, err := staleDrafts(ctx, client, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stale) != 0 {
+		t.Errorf("drafts created just now are stale: %v", stale)
+	}
+
+	stale, err = staleDrafts(ctx, client, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stale) != 1 || stale[0].Id != ids[0] {
+		t.Fatalf("stale drafts are %v, want only draft %d", stale, ids[0])
+	}
+	if err = deleteDrafts(ctx, client, []int{stale[0].Id}); err != nil {
+		t.Fatal(err)
+	}
+	if left := recordIds(t, ctx, client, "draft"); len(left) != 1 || left[0] != ids[1] {
+		t.Errorf("drafts left are %v, want the published draft %d", left, ids[1])
+	}
+}
+
+func TestProductStatusAgainstMockAPI(t *testing.T) {
+	client, done := mockClient(t)
+	defer done()
+	ctx := context.Background()
+
+	draft := Draft{Id: createTestDrafts(t, ctx, client, "Listed")[0]}
+	err, productId := draft.publish(ctx, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := func() string {
+		records, err := listAllRecords(ctx, client, "product")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, record := range records {
+			if record.Id == productId {
+				return record.Draft.Status
+			}
+		}
+		t.Fatalf("product %d not listed", productId)
+		return ""
+	}
+
+	if err = unpublishProduct(ctx, client, productId); err != nil {
+		t.Fatal(err)
+	}
+	if got := status(); got != productStatusOffline {
+		t.Errorf("unpublished product is %q, want %q", got, productStatusOffline)
+	}
+	if err = relistProduct(ctx, client, productId); err != nil {
+		t.Fatal(err)
+	}
+	if got := status(); got != productStatusOnline {
+		t.Errorf("relisted product is %q, want %q", got, productStatusOnline)
+	}
+	if err = unpublishProduct(ctx, client, productId+100); err == nil {
+		t.Errorf("unpublishing a missing product succeeded")
+	}
+}
@@ -3,7 +3,6 @@ package main
 import (
 	"bufio"
 	"io/ioutil"
-	"log"
 	"os"
 	"strings"
 
@@ -15,6 +14,30 @@ type Settings struct {
 	Server        string `yaml:"server,omitempty"`
 	Debug         bool   `yaml:"debug,omitempty"`
 	UploadTimeout int    `yaml:"upload_timeout,omitempty"`
+	APIVersion    int    `yaml:"api_version,omitempty"`
+	Storage       string `yaml:"storage,omitempty"`
+	S3Endpoint    string `yaml:"s3_endpoint,omitempty"`
+	StoragePath   string `yaml:"storage_path,omitempty"`
+	ArchiveCache  string `yaml:"archive_cache,omitempty"`
+	TagSynonyms   string `yaml:"tag_synonyms,omitempty"`
+
+	// Hooks maps before_<step> and after_<step> to shell commands.
+	Hooks map[string]string `yaml:"hooks,omitempty"`
+	// ThumbnailMinWidth and ThumbnailMinHeight replace the default minimum
+	// thumbnail size when set.
+	ThumbnailMinWidth  int `yaml:"thumbnail_min_width,omitempty"`
+	ThumbnailMinHeight int `yaml:"thumbnail_min_height,omitempty"`
+	// TurntableMinFrames and TurntableMaxFrames replace the default limits
+	// on turntable frames when set.
+	TurntableMinFrames int `yaml:"turntable_min_frames,omitempty"`
+	TurntableMaxFrames int `yaml:"turntable_max_frames,omitempty"`
+	// CertificationChecks replaces the local checks for the certification
+	// tiers it names.
+	CertificationChecks map[string]CertificationRequirements `yaml:"certification_checks,omitempty"`
+	// PricePoints replaces defaultPricePoints when set.
+	PricePoints []PricePoints `yaml:"price_points,omitempty"`
+	// Replay is set when the run is replaying a recording.
+	Replay bool `yaml:"-"`
 }
 
 func GetSettings() Settings {
@@ -32,31 +55,64 @@ func GetSettings() Settings {
 			s.Token = text
 			yamlFile, err := yaml.Marshal(s)
 			if err != nil {
-				log.Fatal("Error creating settings yml text: ", err)
+				logger.Fatal("Error creating settings yml text", "error", err)
 			}
 			if err = ioutil.WriteFile("settings.yml", yamlFile, 0644); err != nil {
-				log.Fatal("Error writing setting.yml file: ", err)
+				logger.Fatal("Error writing settings.yml file", "error", err)
 			}
 			println("API Key saved to settings.yml")
 		} else {
-			log.Fatal("Invalid api key entered")
+			logger.Fatal("Invalid api key entered")
 		}
 	}
 
 	err = yaml.Unmarshal(yamlFile, &s)
 	if err != nil {
-		log.Fatalf("settings.yml is not properly formatted: %s", err)
+		logger.Fatal("settings.yml is not properly formatted", "error", err)
+	}
+	s.applyDefaults()
+
+	if s.Token == "" {
+		logger.Fatal("settings.yml must contain a valid API Token")
+	}
+	// Memory storage keeps uploads nowhere the API can reach, so only
+	// tests and replays use it.
+	switch s.Storage {
+	case "", "s3", "filesystem":
+	default:
+		logger.Fatal("settings.yml storage must be s3 or filesystem", "storage", s.Storage)
+	}
+
+	return s
+}
+
+// ReplaySettings are used when replaying a recording, which needs neither
+// settings.yml nor the artist's API token. They use the server and storage
+// the recording was made with, except that filesystem storage is kept in
+// memory so a replay writes nothing.
+func ReplaySettings(replay *ReplayTransport) Settings {
+	s := Settings{Token: "replay", Server: replay.Server(), Replay: true}
+	if recorded := replay.Settings; recorded != nil {
+		s.Server = recorded.Server
+		s.APIVersion = recorded.APIVersion
+		s.Storage = recorded.Storage
+		s.S3Endpoint = recorded.S3Endpoint
+		if s.Storage == "filesystem" {
+			s.Storage = "memory"
+		}
 	}
+	s.applyDefaults()
+	return s
+}
+
+func (s *Settings) applyDefaults() {
 	if s.Server == "" {
 		s.Server = "https://api.turbosquid.com"
 	}
 	if s.UploadTimeout == 0 {
 		s.UploadTimeout = 90
 	}
-
-	if s.Token == "" {
-		log.Fatalf("settings.yml must contain a valid API Token")
+	if s.APIVersion == 0 {
+		s.APIVersion = 1
 	}
-
-	return s
 }
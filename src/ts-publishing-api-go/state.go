@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// StateFileName is written to the product folder when a run is interrupted.
+const StateFileName = ".ts-publishing-state.json"
+
+// AttachedItem is a file or preview that has been attached to the draft.
+type AttachedItem struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	FileIds []int  `json:"file_ids"`
+}
+
+// RunState records what a publishing run has finished so an interrupted run
+// can report it and leave a trace on disk.
+type RunState struct {
+	Directory      string         `json:"-"`
+	StartedAt      time.Time      `json:"started_at"`
+	InterruptedAt  *time.Time     `json:"interrupted_at,omitempty"`
+	DraftId        int            `json:"draft_id,omitempty"`
+	DraftDeleted   bool           `json:"draft_deleted,omitempty"`
+	Files          []AttachedItem `json:"files"`
+	Previews       []AttachedItem `json:"previews"`
+	Certifications []string       `json:"certifications"`
+	ProductId      int            `json:"product_id,omitempty"`
+	// Steps holds the keys of the pipeline steps that finished.
+	Steps []string `json:"steps,omitempty"`
+}
+
+func NewRunState(directory string) *RunState {
+	return &RunState{
+		Directory: directory,
+		StartedAt: time.Now(),
+	}
+}
+
+// LoadRunState reads the state a previous run saved in directory.
+func LoadRunState(directory string) (*RunState, error) {
+	data, err := ioutil.ReadFile(filepath.Join(directory, StateFileName))
+	if err != nil {
+		return nil, err
+	}
+	state := &RunState{}
+	if err = json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("reading %s: %s", StateFileName, err)
+	}
+	state.Directory = directory
+	state.InterruptedAt = nil
+	return state, nil
+}
+
+// attached reports whether items holds a file or preview with this name and
+// type.
+func (state *RunState) attached(items []AttachedItem, name string, itemType string) bool {
+	for _, item := range items {
+		if item.Name == name && item.Type == itemType {
+			return true
+		}
+	}
+	return false
+}
+
+func (state *RunState) addFile(file File) {
+	state.Files = append(state.Files, AttachedItem{Name: file.Name, Type: file.Type, FileIds: []int{file.FileId}})
+}
+
+func (state *RunState) addPreview(preview Preview) {
+	fileIds := preview.FileIds
+	if preview.FileId > 0 {
+		fileIds = []int{preview.FileId}
+	}
+	state.Previews = append(state.Previews, AttachedItem{Name: preview.Name, Type: preview.Type, FileIds: fileIds})
+}
+
+// Save writes the state to StateFileName in the product folder and returns
+// the path written.
+func (state *RunState) Save() (string, error) {
+	now := time.Now()
+	state.InterruptedAt = &now
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(state.Directory, StateFileName)
+	return path, ioutil.WriteFile(path, data, 0644)
+}
+
+// Summary describes what the run finished.
+func (state *RunState) Summary() string {
+	var lines []string
+	if state.DraftId == 0 {
+		lines = append(lines, "No draft was created.")
+	} else if state.DraftDeleted {
+		lines = append(lines, fmt.Sprintf("Draft ID %d was deleted.", state.DraftId))
+	} else {
+		lines = append(lines, fmt.Sprintf("Draft ID %d was created.", state.DraftId))
+	}
+	lines = append(lines, fmt.Sprintf("Files attached: %d", len(state.Files)))
+	for _, item := range state.Files {
+		lines = append(lines, fmt.Sprintf("  %s (%s) %v", item.Name, item.Type, item.FileIds))
+	}
+	lines = append(lines, fmt.Sprintf("Previews attached: %d", len(state.Previews)))
+	for _, item := range state.Previews {
+		lines = append(lines, fmt.Sprintf("  %s (%s) %v", item.Name, item.Type, item.FileIds))
+	}
+	lines = append(lines, fmt.Sprintf("Certifications set: %s", strings.Join(state.Certifications, ", ")))
+	if state.ProductId > 0 {
+		lines = append(lines, fmt.Sprintf("Published product ID: %d", state.ProductId))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (state *RunState) report() {
+	path, err := state.Save()
+	if err != nil {
+		logger.Error("Unable to save run state", "error", err)
+	} else {
+		logger.Info("Run state saved", "path", path)
+	}
+	fmt.Println(state.Summary())
+}
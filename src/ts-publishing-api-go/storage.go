@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	awscreds "github.com/aws/aws-sdk-go/aws/credentials"
+	awssession "github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// ObjectUploader stores the content of a file under key, where the
+// publishing API picks it up once the upload is processed.
+type ObjectUploader interface {
+	Put(ctx context.Context, key string, body io.Reader) error
+}
+
+// S3Uploader sends objects to an S3 bucket.
+type S3Uploader struct {
+	Bucket  string
+	Session *awssession.Session
+}
+
+// NewS3Uploader builds an uploader from temporary upload credentials. A
+// non-empty endpoint points it at an S3-compatible service such as MinIO,
+// using path-style addressing. When apiTransport records or replays API
+// exchanges, S3 requests go through it too.
+func NewS3Uploader(credentials *Credentials, endpoint string, apiTransport http.RoundTripper) (*S3Uploader, error) {
+	// The session gets its own client, since the SDK loads AWS_CA_BUNDLE
+	// into the client's *http.Transport. A recording or replaying transport
+	// is layered over that transport once the session is built.
+	config := &aws.Config{
+		Region:      aws.String(credentials.Region),
+		HTTPClient:  &http.Client{},
+		Credentials: awscreds.NewStaticCredentials(credentials.AccessKey, credentials.SecretKey, credentials.SessionToken),
+	}
+	if endpoint != "" {
+		config.Endpoint = aws.String(endpoint)
+		config.S3ForcePathStyle = aws.Bool(true)
+	}
+	session, err := awssession.NewSession(config)
+	if err != nil {
+		return nil, err
+	}
+	if wrapper, wraps := apiTransport.(transportWrapper); wraps {
+		session.Config.HTTPClient = &http.Client{Transport: wrapper.Wrap(session.Config.HTTPClient.Transport)}
+	}
+	return &S3Uploader{Bucket: credentials.Bucket, Session: session}, nil
+}
+
+// Put uploads body to S3. Cancelling ctx aborts a multipart upload and
+// removes the parts already sent.
+func (uploader *S3Uploader) Put(ctx context.Context, key string, body io.Reader) error {
+	_, err := s3manager.NewUploader(uploader.Session).UploadWithContext(ctx, &s3manager.UploadInput{
+		Bucket: aws.String(uploader.Bucket),
+		Key:    aws.String(key),
+		Body:   body,
+	})
+	return err
+}
+
+// FilesystemUploader writes objects below Root, using the key as a relative
+// path.
+type FilesystemUploader struct {
+	Root string
+}
+
+func (uploader *FilesystemUploader) Put(ctx context.Context, key string, body io.Reader) error {
+	path := filepath.Join(uploader.Root, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(f, &contextReader{ctx: ctx, reader: body}); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	return f.Close()
+}
+
+// MemoryUploader keeps objects in memory. It is used by tests and replays;
+// settings.yml cannot select it.
+type MemoryUploader struct {
+	mu      sync.Mutex
+	Objects map[string][]byte
+}
+
+func NewMemoryUploader() *MemoryUploader {
+	return &MemoryUploader{Objects: map[string][]byte{}}
+}
+
+func (uploader *MemoryUploader) Put(ctx context.Context, key string, body io.Reader) error {
+	data, err := ioutil.ReadAll(&contextReader{ctx: ctx, reader: body})
+	if err != nil {
+		return err
+	}
+	uploader.mu.Lock()
+	defer uploader.mu.Unlock()
+	uploader.Objects[key] = data
+	return nil
+}
+
+// Object returns the content stored under key.
+func (uploader *MemoryUploader) Object(key string) ([]byte, bool) {
+	uploader.mu.Lock()
+	defer uploader.mu.Unlock()
+	data, ok := uploader.Objects[key]
+	return data, ok
+}
+
+// contextReader stops a copy once ctx is cancelled.
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.reader.Read(p)
+}
+
+// newObjectUploader returns the uploader selected by the storage setting.
+func newObjectUploader(settings Settings, credentials *Credentials, apiTransport http.RoundTripper) (ObjectUploader, error) {
+	switch settings.Storage {
+	case "", "s3":
+		return NewS3Uploader(credentials, settings.S3Endpoint, apiTransport)
+	case "filesystem":
+		if settings.StoragePath == "" {
+			return nil, fmt.Errorf("storage_path is required for filesystem storage")
+		}
+		return &FilesystemUploader{Root: filepath.Join(settings.StoragePath, credentials.Bucket)}, nil
+	case "memory":
+		return NewMemoryUploader(), nil
+	}
+	return nil, fmt.Errorf("unknown storage %q", settings.Storage)
+}
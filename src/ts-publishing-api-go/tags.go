@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// TurboSquid's limits on product tags.
+const (
+	maxTags      = 40
+	maxTagLength = 50
+)
+
+// Synonyms maps a normalized tag to the tags that should be added with it.
+type Synonyms map[string][]string
+
+// LoadSynonyms reads a synonym dictionary. Each line names a tag and the tags
+// to add alongside it, e.g. "sofa: couch, settee". Blank lines and lines
+// starting with # are ignored.
+func LoadSynonyms(path string) (Synonyms, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	synonyms := Synonyms{}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		separator := strings.Index(text, ":")
+		if separator < 0 {
+			return nil, fmt.Errorf("%s:%d: expected \"tag: synonym, synonym\"", path, line)
+		}
+		tag := normalizeTag(text[:separator])
+		for _, synonym := range strings.Split(text[separator+1:], ",") {
+			if synonym = normalizeTag(synonym); synonym != "" && synonym != tag {
+				synonyms[tag] = append(synonyms[tag], synonym)
+			}
+		}
+	}
+	return synonyms, scanner.Err()
+}
+
+// normalizeTag lower-cases a tag and collapses its whitespace.
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.Join(strings.Fields(tag), " "))
+}
+
+// TagChange records one thing normalizeTags did to the tag list.
+type TagChange struct {
+	Tag    string
+	Change string
+}
+
+// normalizeTags normalizes and de-duplicates the draft's tags, then adds
+// synonyms while there is room under maxTags. Tags that are too long, or
+// too many tags before synonyms are added, are errors.
+func (draft *Draft) normalizeTags(synonyms Synonyms) ([]TagChange, error) {
+	var changes []TagChange
+	var tags []string
+	seen := map[string]bool{}
+	for _, tag := range draft.Tags {
+		normalized := normalizeTag(tag)
+		switch {
+		case normalized == "":
+			changes = append(changes, TagChange{Tag: tag, Change: "removed empty tag"})
+			continue
+		case seen[normalized]:
+			changes = append(changes, TagChange{Tag: tag, Change: "removed duplicate"})
+			continue
+		case normalized != tag:
+			changes = append(changes, TagChange{Tag: tag, Change: fmt.Sprintf("normalized to %q", normalized)})
+		}
+		seen[normalized] = true
+		tags = append(tags, normalized)
+	}
+
+	var problems []string
+	for _, tag := range tags {
+		if utf8.RuneCountInString(tag) > maxTagLength {
+			problems = append(problems, fmt.Sprintf("%q is longer than %d characters", tag, maxTagLength))
+		}
+	}
+	if len(tags) > maxTags {
+		problems = append(problems, fmt.Sprintf("%d tags, at most %d are allowed", len(tags), maxTags))
+	}
+	if len(problems) > 0 {
+		return changes, fmt.Errorf("tags are not valid:\n  %s", strings.Join(problems, "\n  "))
+	}
+
+	for _, tag := range append([]string(nil), tags...) {
+		for _, synonym := range synonyms[tag] {
+			if seen[synonym] {
+				continue
+			}
+			if len(tags) >= maxTags {
+				changes = append(changes, TagChange{Tag: synonym, Change: fmt.Sprintf("synonym of %q skipped, tag limit reached", tag)})
+				continue
+			}
+			seen[synonym] = true
+			tags = append(tags, synonym)
+			changes = append(changes, TagChange{Tag: synonym, Change: fmt.Sprintf("added as a synonym of %q", tag)})
+		}
+	}
+	draft.Tags = tags
+	return changes, nil
+}
+
+// prepareTags normalizes the draft's tags and logs every change.
+func prepareTags(draft *Draft, synonymsPath string) error {
+	var synonyms Synonyms
+	if synonymsPath != "" {
+		var err error
+		if synonyms, err = LoadSynonyms(synonymsPath); err != nil {
+			return fmt.Errorf("loading tag synonyms: %s", err)
+		}
+	}
+	changes, err := draft.normalizeTags(synonyms)
+	for _, change := range changes {
+		logger.Info("Tag changed", "tag", change.Tag, "change", change.Change)
+	}
+	return err
+}
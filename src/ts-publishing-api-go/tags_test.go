@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func numberedTags(count int) []string {
+	var tags []string
+	for i := 0; i < count; i++ {
+		tags = append(tags, fmt.Sprintf("tag %d", i))
+	}
+	return tags
+}
+
+func TestNormalizeTags(t *testing.T) {
+	tests := []struct {
+		name     string
+		tags     []string
+		synonyms Synonyms
+		want     []string
+		err      bool
+	}{
+		{
+			name: "normalizes and removes duplicates",
+			tags: []string{" Sofa ", "sofa", "", "Big  Chair"},
+			want: []string{"sofa", "big chair"},
+		},
+		{
+			name:     "adds synonyms once",
+			tags:     []string{"sofa", "couch"},
+			synonyms: Synonyms{"sofa": {"couch", "settee"}},
+			want:     []string{"sofa", "couch", "settee"},
+		},
+		{
+			name:     "skips synonyms past the tag limit",
+			tags:     numberedTags(maxTags),
+			synonyms: Synonyms{"tag 0": {"extra"}},
+			want:     numberedTags(maxTags),
+		},
+		{
+			name: "rejects long tags",
+			tags: []string{strings.Repeat("a", maxTagLength+1)},
+			err:  true,
+		},
+		{
+			name: "rejects too many tags",
+			tags: numberedTags(maxTags + 1),
+			err:  true,
+		},
+	}
+	for _, test := range tests {
+		draft := Draft{Tags: test.tags}
+		_, err := draft.normalizeTags(test.synonyms)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: normalizeTags returned no error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: normalizeTags returned %s", test.name, err)
+		} else if !reflect.DeepEqual(draft.Tags, test.want) {
+			t.Errorf("%s: tags = %q, want %q", test.name, draft.Tags, test.want)
+		}
+	}
+}
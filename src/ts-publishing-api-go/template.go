@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// appendSuffix marks a key whose array is appended to the base template's
+// array instead of replacing it, as in "tags+": ["extra"].
+const appendSuffix = "+"
+
+// loadProductJSON reads a product.json and, when it names a base template
+// with "extends", merges it over the template. Templates may extend other
+// templates; paths are relative to the file that names them.
+func loadProductJSON(path string) ([]byte, error) {
+	document, err := loadTemplate(path, map[string]bool{})
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(document)
+}
+
+func loadTemplate(path string, seen map[string]bool) (map[string]interface{}, error) {
+	absolute, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if seen[absolute] {
+		return nil, fmt.Errorf("%s is part of an extends cycle", path)
+	}
+	seen[absolute] = true
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	// Numbers stay as written so prices are not rounded through float64.
+	decoder.UseNumber()
+	var document map[string]interface{}
+	if err = decoder.Decode(&document); err != nil {
+		return nil, fmt.Errorf("parsing %s: %s", path, err)
+	}
+
+	extends, ok := document["extends"]
+	if !ok {
+		return mergeTemplate(map[string]interface{}{}, document), nil
+	}
+	delete(document, "extends")
+	basePath, ok := extends.(string)
+	if !ok || basePath == "" {
+		return nil, fmt.Errorf("%s: extends must be a file path", path)
+	}
+	if !filepath.IsAbs(basePath) {
+		basePath = filepath.Join(filepath.Dir(path), basePath)
+	}
+	base, err := loadTemplate(basePath, seen)
+	if err != nil {
+		return nil, fmt.Errorf("loading template %s: %s", basePath, err)
+	}
+	logger.Debug("Extending template", "path", path, "template", basePath)
+	return mergeTemplate(base, document), nil
+}
+
+// mergeTemplate merges override into base. Objects are merged key by key,
+// arrays and other values replace the base value, "key+" arrays are appended
+// to the base array and an explicit null removes the key.
+func mergeTemplate(base map[string]interface{}, override map[string]interface{}) map[string]interface{} {
+	merged := map[string]interface{}{}
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range override {
+		if strings.HasSuffix(key, appendSuffix) {
+			key = strings.TrimSuffix(key, appendSuffix)
+			existing, _ := merged[key].([]interface{})
+			if values, ok := value.([]interface{}); ok {
+				merged[key] = append(append([]interface{}{}, existing...), values...)
+				continue
+			}
+		}
+		if value == nil {
+			delete(merged, key)
+			continue
+		}
+		overrideObject, overrideIsObject := value.(map[string]interface{})
+		baseObject, baseIsObject := merged[key].(map[string]interface{})
+		if overrideIsObject && baseIsObject {
+			merged[key] = mergeTemplate(baseObject, overrideObject)
+		} else if overrideIsObject {
+			merged[key] = mergeTemplate(map[string]interface{}{}, overrideObject)
+		} else {
+			merged[key] = value
+		}
+	}
+	return merged
+}
+
+func runRender(command *Command, args []string) error {
+	flags := newCommandFlags(command)
+	vars := varFlags{}
+	flags.Var(vars, "var", "Set a template variable as key=value. May be repeated.")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	output, err := renderProduct(ReadInput(flags.Arg(0), vars))
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(output))
+	return nil
+}
+
+// renderProduct returns productBundle as a product.json that reads back as
+// the same product. Values ReadInput derives are written in their resolved
+// form: the price as a price object and a description_file as the converted
+// description. Upload results are left out.
+func renderProduct(productBundle ProductBundle) ([]byte, error) {
+	draft := &productBundle.Draft
+	draft.PriceUsd = DecimalPrice{}
+	draft.PriceCents = nil
+	draft.DescriptionFile = ""
+
+	productBundle.Files = append([]File(nil), productBundle.Files...)
+	for i := range productBundle.Files {
+		file := &productBundle.Files[i]
+		file.FileId = 0
+		file.Source = ""
+	}
+	productBundle.Previews = append([]Preview(nil), productBundle.Previews...)
+	for i := range productBundle.Previews {
+		preview := &productBundle.Previews[i]
+		preview.FileId = 0
+		preview.FileIds = nil
+		preview.Source = ""
+		preview.FramePaths = nil
+	}
+	return json.MarshalIndent(productBundle, "", "  ")
+}
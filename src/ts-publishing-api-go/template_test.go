@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMergeTemplate(t *testing.T) {
+	tests := []struct {
+		name     string
+		base     string
+		override string
+		want     string
+	}{
+		{
+			name:     "merges objects key by key",
+			base:     `{"product": {"name": "Chair", "license": "editorial"}}`,
+			override: `{"product": {"name": "Office Chair"}}`,
+			want:     `{"product": {"name": "Office Chair", "license": "editorial"}}`,
+		},
+		{
+			name:     "replaces arrays",
+			base:     `{"tags": ["a", "b"]}`,
+			override: `{"tags": ["c"]}`,
+			want:     `{"tags": ["c"]}`,
+		},
+		{
+			name:     "appends arrays",
+			base:     `{"tags": ["a", "b"]}`,
+			override: `{"tags+": ["c"]}`,
+			want:     `{"tags": ["a", "b", "c"]}`,
+		},
+		{
+			name:     "appends to a missing array",
+			base:     `{}`,
+			override: `{"tags+": ["c"]}`,
+			want:     `{"tags": ["c"]}`,
+		},
+		{
+			name:     "null removes a key",
+			base:     `{"product": {"name": "Chair", "description": "Old"}}`,
+			override: `{"product": {"description": null}}`,
+			want:     `{"product": {"name": "Chair"}}`,
+		},
+		{
+			name:     "replaces an object with a value",
+			base:     `{"vars": {"a": 1}}`,
+			override: `{"vars": "none"}`,
+			want:     `{"vars": "none"}`,
+		},
+	}
+	decode := func(text string) map[string]interface{} {
+		var document map[string]interface{}
+		if err := json.Unmarshal([]byte(text), &document); err != nil {
+			t.Fatal(err)
+		}
+		return document
+	}
+	for _, test := range tests {
+		base := decode(test.base)
+		merged := mergeTemplate(base, decode(test.override))
+		if want := decode(test.want); !reflect.DeepEqual(merged, want) {
+			t.Errorf("%s: mergeTemplate = %v, want %v", test.name, merged, want)
+		}
+		if !reflect.DeepEqual(base, decode(test.base)) {
+			t.Errorf("%s: mergeTemplate changed its base to %v", test.name, base)
+		}
+	}
+}
+
+// TestRenderRoundTrip checks that rendered output can be read back as the
+// same product.
+func TestRenderRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ts-publishing-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(saved *Logger) { logger = saved }(logger)
+	logger, _ = NewLogger(ioutil.Discard, LevelInfo, "text")
+
+	files := map[string]string{
+		"base.json": `{"product": {"license": "royalty_free_all_extended_uses", "tags": ["furniture"]}}`,
+		"product.json": `{
+			"extends": "base.json",
+			"product": {"name": "{{.Vars.model}} Chair", "price_usd": "149", "description_file": "description.md", "tags+": ["{{.Vars.model}}"]},
+			"files": [{"pattern": "*.obj", "type": "product_file", "is_native": true}],
+			"vars": {"model": "Eames"}
+		}`,
+		"description.md": "A **lounge** chair.\n",
+		"chair.obj":      "v 0 0 0\nv 1 0 0\nv 1 1 0\nf 1 2 3\n",
+	}
+	for name, data := range files {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rendered, err := renderProduct(ReadInput(dir, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reread := filepath.Join(dir, "rendered.json")
+	if err = ioutil.WriteFile(reread, rendered, 0644); err != nil {
+		t.Fatal(err)
+	}
+	again, err := renderProduct(ReadInput(reread, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(again) != string(rendered) {
+		t.Errorf("rendering the rendered product changed it:\n%s\nwant\n%s", again, rendered)
+	}
+
+	var document struct {
+		Product map[string]interface{} `json:"product"`
+	}
+	if err = json.Unmarshal(rendered, &document); err != nil {
+		t.Fatal(err)
+	}
+	if document.Product["name"] != "Eames Chair" || document.Product["price_usd"] != nil || document.Product["description_file"] != "" {
+		t.Errorf("rendered product is %v", document.Product)
+	}
+}
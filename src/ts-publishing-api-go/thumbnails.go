@@ -0,0 +1,353 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ThumbnailRules are the requirements TurboSquid places on preview images.
+type ThumbnailRules struct {
+	Formats   []string
+	MinWidth  int
+	MinHeight int
+	// Aspects are allowed width:height ratios, matched within AspectTolerance.
+	Aspects         [][2]int
+	AspectTolerance float64
+}
+
+const (
+	// defaultThumbnailWidth and defaultThumbnailHeight are the smallest
+	// thumbnail TurboSquid's product listing guidelines ask for.
+	// thumbnail_min_width and thumbnail_min_height in settings.yml replace
+	// them if the guidelines change.
+	defaultThumbnailWidth  = 1200
+	defaultThumbnailHeight = 900
+)
+
+var thumbnailRules = ThumbnailRules{
+	Formats:         []string{"jpeg", "png"},
+	MinWidth:        defaultThumbnailWidth,
+	MinHeight:       defaultThumbnailHeight,
+	Aspects:         [][2]int{{1, 1}, {4, 3}, {16, 9}},
+	AspectTolerance: 0.01,
+}
+
+// ThumbnailProcessing converts a thumbnail before upload. Width and Height
+// give the target size: the image is scaled to fit inside it and, when Pad
+// is set, centred on a Background coloured canvas of exactly that size.
+type ThumbnailProcessing struct {
+	Width      int    `json:"width"`
+	Height     int    `json:"height"`
+	Pad        bool   `json:"pad"`
+	Background string `json:"background"`
+	Format     string `json:"format"`
+	Quality    int    `json:"quality"`
+}
+
+// ImageInfo describes an image file without decoding its pixels.
+type ImageInfo struct {
+	Path       string
+	Format     string
+	Width      int
+	Height     int
+	ColorModel string
+}
+
+func inspectImage(path string) (ImageInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return ImageInfo{}, err
+	}
+	defer f.Close()
+
+	config, format, err := image.DecodeConfig(f)
+	if err != nil {
+		return ImageInfo{}, fmt.Errorf("%s is not a readable image: %s", path, err)
+	}
+	return ImageInfo{
+		Path:       path,
+		Format:     format,
+		Width:      config.Width,
+		Height:     config.Height,
+		ColorModel: colorModelName(config.ColorModel),
+	}, nil
+}
+
+func colorModelName(model color.Model) string {
+	switch model {
+	case color.GrayModel, color.Gray16Model:
+		return "grayscale"
+	case color.CMYKModel:
+		return "CMYK"
+	case color.AlphaModel, color.Alpha16Model:
+		return "alpha"
+	}
+	if _, ok := model.(color.Palette); ok {
+		return "paletted"
+	}
+	return "RGB"
+}
+
+// Problems lists every rule the image breaks.
+func (rules ThumbnailRules) Problems(info ImageInfo) []string {
+	var problems []string
+	if !containsString(rules.Formats, info.Format) {
+		problems = append(problems, fmt.Sprintf("format %s is not one of %s", info.Format, strings.Join(rules.Formats, ", ")))
+	}
+	if info.Width < rules.MinWidth || info.Height < rules.MinHeight {
+		problems = append(problems, fmt.Sprintf("%dx%d is smaller than %dx%d", info.Width, info.Height, rules.MinWidth, rules.MinHeight))
+	}
+	if !rules.aspectAllowed(info.Width, info.Height) {
+		problems = append(problems, fmt.Sprintf("aspect ratio %.3f is not one of %s", float64(info.Width)/float64(info.Height), rules.aspectNames()))
+	}
+	if info.ColorModel != "RGB" && info.ColorModel != "paletted" {
+		problems = append(problems, fmt.Sprintf("colour mode %s is not RGB", info.ColorModel))
+	}
+	return problems
+}
+
+// thumbnailRulesFor returns thumbnailRules with the minimum size from
+// settings, where it is set.
+func thumbnailRulesFor(settings Settings) ThumbnailRules {
+	rules := thumbnailRules
+	if settings.ThumbnailMinWidth > 0 {
+		rules.MinWidth = settings.ThumbnailMinWidth
+	}
+	if settings.ThumbnailMinHeight > 0 {
+		rules.MinHeight = settings.ThumbnailMinHeight
+	}
+	return rules
+}
+
+func (rules ThumbnailRules) aspectAllowed(width int, height int) bool {
+	if height == 0 {
+		return false
+	}
+	ratio := float64(width) / float64(height)
+	for _, aspect := range rules.Aspects {
+		expected := float64(aspect[0]) / float64(aspect[1])
+		if math.Abs(ratio-expected)/expected <= rules.AspectTolerance {
+			return true
+		}
+	}
+	return false
+}
+
+func (rules ThumbnailRules) aspectNames() string {
+	var names []string
+	for _, aspect := range rules.Aspects {
+		names = append(names, fmt.Sprintf("%d:%d", aspect[0], aspect[1]))
+	}
+	return strings.Join(names, ", ")
+}
+
+// prepareThumbnails checks every thumbnail against rules, converting
+// those with a process block into tempDir first. All problems are reported
+// together so they can be fixed before anything is uploaded.
+func prepareThumbnails(productBundle *ProductBundle, tempDir string, rules ThumbnailRules) error {
+	var problems []string
+	for i := range productBundle.Previews {
+		preview := &productBundle.Previews[i]
+		if preview.Type != "thumbnail" && preview.Type != "wireframe" {
+			continue
+		}
+		source := filepath.Join(productBundle.Directory, preview.Name)
+		if preview.Process != nil {
+			// Each preview gets its own directory, so previews with the same
+			// base name do not overwrite each other.
+			processed, err := processThumbnail(source, *preview.Process, filepath.Join(tempDir, fmt.Sprintf("preview-%d", i)))
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %s", preview.Name, err))
+				continue
+			}
+			logger.Debug("Processed thumbnail", "preview", preview.Name, "output", processed)
+			source = processed
+			preview.Source = processed
+		}
+
+		info, err := inspectImage(source)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %s", preview.Name, err))
+			continue
+		}
+		for _, problem := range rules.Problems(info) {
+			problems = append(problems, fmt.Sprintf("%s: %s", preview.Name, problem))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("thumbnails do not meet TurboSquid's preview rules:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// processThumbnail writes a converted copy of source into outputDir and
+// returns its path.
+func processThumbnail(source string, process ThumbnailProcessing, outputDir string) (string, error) {
+	f, err := os.Open(source)
+	if err != nil {
+		return "", err
+	}
+	img, format, err := image.Decode(f)
+	f.Close()
+	if err != nil {
+		return "", fmt.Errorf("unable to decode image: %s", err)
+	}
+
+	background, err := parseHexColor(process.Background)
+	if err != nil {
+		return "", err
+	}
+	if process.Width < 0 || process.Height < 0 || (process.Width == 0) != (process.Height == 0) {
+		return "", fmt.Errorf("width and height must both be positive, got %dx%d", process.Width, process.Height)
+	}
+	if process.Width > 0 {
+		bounds := img.Bounds()
+		scale := math.Min(float64(process.Width)/float64(bounds.Dx()), float64(process.Height)/float64(bounds.Dy()))
+		width := int(math.Round(float64(bounds.Dx()) * scale))
+		height := int(math.Round(float64(bounds.Dy()) * scale))
+		if img, err = scaleImage(img, width, height); err != nil {
+			return "", err
+		}
+		if process.Pad {
+			img = padImage(img, process.Width, process.Height, background)
+		}
+	} else if process.Pad {
+		return "", fmt.Errorf("pad needs width and height")
+	}
+
+	if process.Format != "" {
+		format = strings.ToLower(process.Format)
+		if format == "jpg" {
+			format = "jpeg"
+		}
+	}
+	extension := map[string]string{"jpeg": ".jpg", "png": ".png"}[format]
+	if extension == "" {
+		return "", fmt.Errorf("cannot write %s images", format)
+	}
+
+	base := strings.TrimSuffix(filepath.Base(source), filepath.Ext(source))
+	if err = os.MkdirAll(outputDir, 0755); err != nil {
+		return "", err
+	}
+	output := filepath.Join(outputDir, base+extension)
+	out, err := os.Create(output)
+	if err != nil {
+		return "", err
+	}
+	if format == "jpeg" {
+		quality := process.Quality
+		if quality == 0 {
+			quality = 92
+		}
+		// JPEG has no alpha channel, so transparent areas take the
+		// background colour.
+		bounds := img.Bounds()
+		err = jpeg.Encode(out, padImage(img, bounds.Dx(), bounds.Dy(), background), &jpeg.Options{Quality: quality})
+	} else {
+		err = png.Encode(out, toRGBA(img))
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return output, err
+}
+
+// toRGBA converts any colour model, including grayscale and CMYK, to RGB.
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok {
+		return rgba
+	}
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Src)
+	return rgba
+}
+
+// scaleImage resizes img with bilinear interpolation. Both dimensions of the
+// source and the target must be at least one pixel.
+func scaleImage(img image.Image, width int, height int) (*image.RGBA, error) {
+	if width < 1 || height < 1 {
+		return nil, fmt.Errorf("cannot scale to %dx%d", width, height)
+	}
+	src := toRGBA(img)
+	if src.Bounds().Empty() {
+		return nil, fmt.Errorf("cannot scale an empty image")
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	srcWidth, srcHeight := src.Bounds().Dx(), src.Bounds().Dy()
+	xRatio := float64(srcWidth) / float64(width)
+	yRatio := float64(srcHeight) / float64(height)
+
+	for y := 0; y < height; y++ {
+		sy := math.Max(0, (float64(y)+0.5)*yRatio-0.5)
+		y0 := int(sy)
+		y1 := minInt(y0+1, srcHeight-1)
+		fy := sy - float64(y0)
+		for x := 0; x < width; x++ {
+			sx := math.Max(0, (float64(x)+0.5)*xRatio-0.5)
+			x0 := int(sx)
+			x1 := minInt(x0+1, srcWidth-1)
+			fx := sx - float64(x0)
+
+			offset := dst.PixOffset(x, y)
+			for channel := 0; channel < 4; channel++ {
+				top := lerp(float64(src.Pix[src.PixOffset(x0, y0)+channel]), float64(src.Pix[src.PixOffset(x1, y0)+channel]), fx)
+				bottom := lerp(float64(src.Pix[src.PixOffset(x0, y1)+channel]), float64(src.Pix[src.PixOffset(x1, y1)+channel]), fx)
+				dst.Pix[offset+channel] = uint8(math.Round(lerp(top, bottom, fy)))
+			}
+		}
+	}
+	return dst, nil
+}
+
+func padImage(img image.Image, width int, height int, background color.Color) *image.RGBA {
+	canvas := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(canvas, canvas.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+	bounds := img.Bounds()
+	offset := image.Pt((width-bounds.Dx())/2, (height-bounds.Dy())/2)
+	draw.Draw(canvas, bounds.Sub(bounds.Min).Add(offset), img, bounds.Min, draw.Over)
+	return canvas
+}
+
+// parseHexColor reads "#rrggbb", defaulting to white.
+func parseHexColor(hex string) (color.Color, error) {
+	hex = strings.TrimPrefix(hex, "#")
+	if hex == "" {
+		return color.White, nil
+	}
+	value, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil || len(hex) != 6 {
+		return nil, fmt.Errorf("invalid background colour %q", hex)
+	}
+	return color.RGBA{R: uint8(value >> 16), G: uint8(value >> 8), B: uint8(value), A: 255}, nil
+}
+
+func lerp(a float64, b float64, t float64) float64 {
+	return a + (b-a)*t
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testPNG returns an opaque PNG of the given size.
+func testPNG(t *testing.T, width int, height int) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestScaleImageRejectsEmptyTargets(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for _, size := range [][2]int{{0, 4}, {4, 0}, {-1, 4}} {
+		if _, err := scaleImage(img, size[0], size[1]); err == nil {
+			t.Errorf("scaleImage to %dx%d succeeded", size[0], size[1])
+		}
+	}
+	scaled, err := scaleImage(img, 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scaled.Bounds().Dx() != 2 || scaled.Bounds().Dy() != 3 {
+		t.Errorf("scaleImage returned %v, want 2x3", scaled.Bounds())
+	}
+}
+
+func TestProcessThumbnailSizes(t *testing.T) {
+	source := writeTestFile(t, "render.png", testPNG(t, 4000, 10))
+	defer os.RemoveAll(filepath.Dir(source))
+
+	tests := []struct {
+		process ThumbnailProcessing
+		err     bool
+	}{
+		{process: ThumbnailProcessing{Width: 400, Height: 300}},
+		{process: ThumbnailProcessing{Width: 400}, err: true},
+		{process: ThumbnailProcessing{Width: -400, Height: 300}, err: true},
+		// 4000x10 fitted inside 100x100 would be less than a pixel high.
+		{process: ThumbnailProcessing{Width: 100, Height: 100}, err: true},
+		{process: ThumbnailProcessing{Pad: true}, err: true},
+	}
+	for i, test := range tests {
+		_, err := processThumbnail(source, test.process, filepath.Join(filepath.Dir(source), "out"))
+		if test.err && err == nil {
+			t.Errorf("test %d: processThumbnail(%+v) succeeded", i, test.process)
+		} else if !test.err && err != nil {
+			t.Errorf("test %d: processThumbnail(%+v) returned %s", i, test.process, err)
+		}
+	}
+}
+
+func TestThumbnailRulesFor(t *testing.T) {
+	rules := thumbnailRulesFor(Settings{})
+	if rules.MinWidth != defaultThumbnailWidth || rules.MinHeight != defaultThumbnailHeight {
+		t.Errorf("default minimum is %dx%d", rules.MinWidth, rules.MinHeight)
+	}
+	rules = thumbnailRulesFor(Settings{ThumbnailMinWidth: 1600, ThumbnailMinHeight: 1200})
+	if rules.MinWidth != 1600 || rules.MinHeight != 1200 {
+		t.Errorf("configured minimum is %dx%d, want 1600x1200", rules.MinWidth, rules.MinHeight)
+	}
+	if problems := rules.Problems(ImageInfo{Format: "png", Width: 1200, Height: 900, ColorModel: "RGB"}); len(problems) != 1 {
+		t.Errorf("1200x900 against a 1600x1200 minimum gave %q", problems)
+	}
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// turntableExtensions are the image types accepted as turntable frames.
+// Anything else in a turntable directory, such as Thumbs.db, is skipped.
+var turntableExtensions = []string{".jpg", ".jpeg", ".png"}
+
+const (
+	// defaultMinTurntableFrames and defaultMaxTurntableFrames bound the
+	// frames in a turntable, following TurboSquid's listing guidelines.
+	// turntable_min_frames and turntable_max_frames in settings.yml replace
+	// them.
+	defaultMinTurntableFrames = 12
+	defaultMaxTurntableFrames = 96
+)
+
+// SpriteSheet describes a turntable supplied as a single image holding the
+// frames in a grid, read left to right and top to bottom. Frames may be less
+// than Columns*Rows when the last row is not full.
+type SpriteSheet struct {
+	Columns int `json:"columns"`
+	Rows    int `json:"rows"`
+	Frames  int `json:"frames"`
+}
+
+// naturalLess orders names so that embedded numbers compare by value:
+// frame2.png sorts before frame10.png.
+func naturalLess(a string, b string) bool {
+	for a != "" && b != "" {
+		aDigits, bDigits := leadingDigits(a), leadingDigits(b)
+		if aDigits != "" && bDigits != "" {
+			aTrim, bTrim := strings.TrimLeft(aDigits, "0"), strings.TrimLeft(bDigits, "0")
+			if len(aTrim) != len(bTrim) {
+				return len(aTrim) < len(bTrim)
+			}
+			if aTrim != bTrim {
+				return aTrim < bTrim
+			}
+			if len(aDigits) != len(bDigits) {
+				return len(aDigits) < len(bDigits)
+			}
+			a, b = a[len(aDigits):], b[len(bDigits):]
+			continue
+		}
+		aRune, bRune := unicode.ToLower(rune(a[0])), unicode.ToLower(rune(b[0]))
+		if aRune != bRune {
+			return aRune < bRune
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) < len(b)
+}
+
+func leadingDigits(s string) string {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	return s[:i]
+}
+
+// sequenceNumber returns the last number in a file name, if any.
+func sequenceNumber(name string) (int, bool) {
+	base := strings.TrimSuffix(name, filepath.Ext(name))
+	end := len(base)
+	for end > 0 && (base[end-1] < '0' || base[end-1] > '9') {
+		end--
+	}
+	start := end
+	for start > 0 && base[start-1] >= '0' && base[start-1] <= '9' {
+		start--
+	}
+	if start == end {
+		return 0, false
+	}
+	number, err := strconv.Atoi(base[start:end])
+	return number, err == nil
+}
+
+func isTurntableFrame(name string) bool {
+	if strings.HasPrefix(filepath.Base(name), ".") {
+		return false
+	}
+	return containsString(turntableExtensions, strings.ToLower(filepath.Ext(name)))
+}
+
+// turntableFrames lists the frames of a turntable preview in upload order.
+func turntableFrames(directory string, preview Preview, tempDir string) ([]string, error) {
+	if preview.SpriteSheet != nil {
+		return splitSpriteSheet(filepath.Join(directory, preview.Name), *preview.SpriteSheet, tempDir)
+	}
+
+	var candidates []string
+	if preview.Frames != "" {
+		matches, err := filepath.Glob(filepath.Join(directory, preview.Frames))
+		if err != nil {
+			return nil, fmt.Errorf("invalid frames pattern %q: %s", preview.Frames, err)
+		}
+		candidates = matches
+	} else {
+		files, err := ioutil.ReadDir(filepath.Join(directory, preview.Name))
+		if err != nil {
+			return nil, fmt.Errorf("reading turntable directory: %s", err)
+		}
+		for _, file := range files {
+			if !file.IsDir() {
+				candidates = append(candidates, filepath.Join(directory, preview.Name, file.Name()))
+			}
+		}
+	}
+
+	var frames []string
+	for _, candidate := range candidates {
+		if !isTurntableFrame(candidate) {
+			logger.Debug("Skipping turntable file", "preview", preview.Name, "file", filepath.Base(candidate))
+			continue
+		}
+		frames = append(frames, candidate)
+	}
+	sort.SliceStable(frames, func(i, j int) bool {
+		return naturalLess(filepath.Base(frames[i]), filepath.Base(frames[j]))
+	})
+	return frames, nil
+}
+
+// turntableFrameLimits returns the smallest and largest number of frames a
+// turntable may have.
+func turntableFrameLimits(settings Settings) (int, int) {
+	minFrames, maxFrames := defaultMinTurntableFrames, defaultMaxTurntableFrames
+	if settings.TurntableMinFrames > 0 {
+		minFrames = settings.TurntableMinFrames
+	}
+	if settings.TurntableMaxFrames > 0 {
+		maxFrames = settings.TurntableMaxFrames
+	}
+	return minFrames, maxFrames
+}
+
+// checkTurntableFrames reports a frame count outside minFrames..maxFrames,
+// frames whose size differs from the first frame, and frame numbers that are
+// missing or used twice, such as frame1.png and frame01.png.
+func checkTurntableFrames(frames []string, minFrames int, maxFrames int) []string {
+	var problems []string
+	if len(frames) < minFrames || len(frames) > maxFrames {
+		problems = append(problems, fmt.Sprintf("has %d frames, expected between %d and %d", len(frames), minFrames, maxFrames))
+	}
+
+	var first ImageInfo
+	for i, frame := range frames {
+		info, err := inspectImage(frame)
+		if err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		if i == 0 {
+			first = info
+		} else if info.Width != first.Width || info.Height != first.Height {
+			problems = append(problems, fmt.Sprintf("%s is %dx%d but %s is %dx%d",
+				filepath.Base(frame), info.Width, info.Height, filepath.Base(frames[0]), first.Width, first.Height))
+		}
+	}
+
+	var numbers []int
+	numbered := 0
+	named := map[int]string{}
+	for _, frame := range frames {
+		number, ok := sequenceNumber(filepath.Base(frame))
+		if !ok {
+			continue
+		}
+		numbered++
+		if other, seen := named[number]; seen {
+			problems = append(problems, fmt.Sprintf("%s and %s both have frame number %d", other, filepath.Base(frame), number))
+			continue
+		}
+		named[number] = filepath.Base(frame)
+		numbers = append(numbers, number)
+	}
+	if numbered == len(frames) && len(numbers) > 1 {
+		sort.Ints(numbers)
+		var missing []string
+		for i := 1; i < len(numbers); i++ {
+			for n := numbers[i-1] + 1; n < numbers[i]; n++ {
+				missing = append(missing, strconv.Itoa(n))
+			}
+		}
+		if len(missing) > 0 {
+			problems = append(problems, fmt.Sprintf("frame numbers missing from the sequence: %s", strings.Join(missing, ", ")))
+		}
+	}
+	return problems
+}
+
+// prepareTurntables resolves and checks the frames of every turntable,
+// storing them on the preview for upload.
+func prepareTurntables(productBundle *ProductBundle, tempDir string, settings Settings) error {
+	minFrames, maxFrames := turntableFrameLimits(settings)
+	var problems []string
+	for i := range productBundle.Previews {
+		preview := &productBundle.Previews[i]
+		if preview.Type != "turntable" {
+			continue
+		}
+		// Sprite sheets are split into a directory per preview, so sheets
+		// with the same base name do not overwrite each other's frames.
+		frames, err := turntableFrames(productBundle.Directory, *preview, filepath.Join(tempDir, fmt.Sprintf("preview-%d", i)))
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %s", preview.Name, err))
+			continue
+		}
+		for _, problem := range checkTurntableFrames(frames, minFrames, maxFrames) {
+			problems = append(problems, fmt.Sprintf("%s: %s", preview.Name, problem))
+		}
+		preview.FramePaths = frames
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("turntables are not valid:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// splitSpriteSheet cuts a sprite sheet into numbered frame files in tempDir.
+func splitSpriteSheet(path string, sheet SpriteSheet, tempDir string) ([]string, error) {
+	if sheet.Columns < 1 || sheet.Rows < 1 {
+		return nil, fmt.Errorf("sprite_sheet needs columns and rows")
+	}
+	count := sheet.Frames
+	if count == 0 {
+		count = sheet.Columns * sheet.Rows
+	}
+	if count > sheet.Columns*sheet.Rows {
+		return nil, fmt.Errorf("sprite_sheet has %d cells but %d frames", sheet.Columns*sheet.Rows, count)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	img, format, err := image.Decode(f)
+	f.Close()
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode sprite sheet: %s", err)
+	}
+	bounds := img.Bounds()
+	if bounds.Dx()%sheet.Columns != 0 || bounds.Dy()%sheet.Rows != 0 {
+		return nil, fmt.Errorf("%dx%d sprite sheet does not divide into %d columns and %d rows", bounds.Dx(), bounds.Dy(), sheet.Columns, sheet.Rows)
+	}
+	width, height := bounds.Dx()/sheet.Columns, bounds.Dy()/sheet.Rows
+
+	frameDir := filepath.Join(tempDir, strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))+"_frames")
+	if err = os.MkdirAll(frameDir, 0755); err != nil {
+		return nil, err
+	}
+	rgba := toRGBA(img)
+	var frames []string
+	for i := 0; i < count; i++ {
+		column, row := i%sheet.Columns, i/sheet.Columns
+		cell := image.Rect(column*width, row*height, (column+1)*width, (row+1)*height)
+		frame := rgba.SubImage(cell)
+
+		extension := ".png"
+		if format == "jpeg" {
+			extension = ".jpg"
+		}
+		output := filepath.Join(frameDir, fmt.Sprintf("frame_%03d%s", i+1, extension))
+		out, err := os.Create(output)
+		if err != nil {
+			return nil, err
+		}
+		if format == "jpeg" {
+			err = jpeg.Encode(out, frame, &jpeg.Options{Quality: 92})
+		} else {
+			err = png.Encode(out, frame)
+		}
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return nil, err
+		}
+		frames = append(frames, output)
+	}
+	return frames, nil
+}
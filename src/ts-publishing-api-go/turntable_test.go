@@ -0,0 +1,82 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNaturalLess(t *testing.T) {
+	tests := []struct {
+		a, b string
+		less bool
+	}{
+		{"frame2.png", "frame10.png", true},
+		{"frame10.png", "frame2.png", false},
+		{"frame_009.png", "frame_010.png", true},
+		{"frame2.png", "frame02.png", true},
+		{"frame02.png", "frame2.png", false},
+		{"a.png", "B.png", true},
+		{"B.png", "a.png", false},
+		{"a", "ab", true},
+		{"a", "a", false},
+	}
+	for _, test := range tests {
+		if less := naturalLess(test.a, test.b); less != test.less {
+			t.Errorf("naturalLess(%q, %q) = %v, want %v", test.a, test.b, less, test.less)
+		}
+	}
+}
+
+func TestCheckTurntableFrames(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ts-publishing-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	frame := testPNG(t, 4, 4)
+	frames := func(names ...string) []string {
+		var paths []string
+		for _, name := range names {
+			path := filepath.Join(dir, name)
+			if err := ioutil.WriteFile(path, frame, 0644); err != nil {
+				t.Fatal(err)
+			}
+			paths = append(paths, path)
+		}
+		return paths
+	}
+
+	tests := []struct {
+		frames   []string
+		min, max int
+		problems []string
+	}{
+		{frames: frames("frame1.png", "frame2.png", "frame3.png"), min: 3, max: 3},
+		{frames: frames("frame1.png", "frame2.png"), min: 3, max: 4, problems: []string{"has 2 frames, expected between 3 and 4"}},
+		{frames: frames("frame1.png", "frame2.png", "frame4.png"), min: 1, max: 10, problems: []string{"frame numbers missing from the sequence: 3"}},
+		{frames: frames("frame1.png", "frame01.png", "frame2.png"), min: 1, max: 10, problems: []string{"frame1.png and frame01.png both have frame number 1"}},
+		{frames: frames("frame1.png", "frame01.png", "frame3.png"), min: 1, max: 10, problems: []string{
+			"frame1.png and frame01.png both have frame number 1",
+			"frame numbers missing from the sequence: 2",
+		}},
+		{frames: frames("front.png", "frame3.png"), min: 1, max: 10},
+	}
+	for i, test := range tests {
+		problems := checkTurntableFrames(test.frames, test.min, test.max)
+		if strings.Join(problems, "; ") != strings.Join(test.problems, "; ") {
+			t.Errorf("test %d: checkTurntableFrames = %q, want %q", i, problems, test.problems)
+		}
+	}
+}
+
+func TestTurntableFrameLimits(t *testing.T) {
+	if minFrames, maxFrames := turntableFrameLimits(Settings{}); minFrames != 12 || maxFrames != 96 {
+		t.Errorf("default limits are %d and %d", minFrames, maxFrames)
+	}
+	if minFrames, maxFrames := turntableFrameLimits(Settings{TurntableMinFrames: 24, TurntableMaxFrames: 72}); minFrames != 24 || maxFrames != 72 {
+		t.Errorf("configured limits are %d and %d, want 24 and 72", minFrames, maxFrames)
+	}
+}
@@ -1,19 +1,11 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"fmt"
-	"log"
-	"net/http"
 	"os"
 	"path/filepath"
 	"time"
-
-	"github.com/aws/aws-sdk-go/aws"
-	awscreds "github.com/aws/aws-sdk-go/aws/credentials"
-	awssession "github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3/s3manager"
-	"github.com/google/jsonapi"
 )
 
 type Credentials struct {
@@ -25,7 +17,7 @@ type Credentials struct {
 	SessionToken string     `jsonapi:"attr,session_token"`
 	Expiration   *time.Time `jsonapi:"attr,expiration,iso8601"`
 	Region       string     `jsonapi:"attr,region"`
-	Session      *awssession.Session
+	Uploader     ObjectUploader
 }
 
 type Upload struct {
@@ -36,50 +28,49 @@ type Upload struct {
 	FileId    int    `jsonapi:"attr,file_id,omitempty"`
 }
 
-func (credentials *Credentials) Upload(directory string, filePath string, settings Settings) (error, int) {
-	if err := credentials.checkExpired(settings); err != nil {
-		log.Fatalf("Failure getting credentials: %s", err)
+func (credentials *Credentials) Upload(ctx context.Context, directory string, filePath string, client *Client, settings Settings) (error, int) {
+	if err := credentials.checkExpired(ctx, client, settings); err != nil {
+		return fmt.Errorf("failure getting credentials: %s", err), 0
 	}
-	log.Printf("Uploading file %s", filePath)
+	logger.Info("Uploading file", "file", filePath)
 
-	err, upload := credentials.UploadFile(fmt.Sprintf("%s/%s", directory, filePath))
+	err, upload := credentials.UploadFile(ctx, filepath.Join(directory, filePath))
 	if err != nil {
-		log.Fatalf("Failure uploading file: %s", err)
+		return fmt.Errorf("failure uploading file: %s", err), 0
 	}
 
-	if settings.Debug {
-		log.Printf("Processing file %s", filePath)
-	}
-	if err = processUpload(settings, &upload); err != nil {
-		log.Fatalf("Failure processing upload: %s", err)
+	logger.Debug("Processing file", "file", filePath, "upload_key", upload.UploadKey)
+	if err = processUpload(ctx, client, &upload); err != nil {
+		return fmt.Errorf("failure processing upload: %s", err), 0
 	}
 
-	if settings.Debug {
-		log.Printf("Polling process file %s: %s", filePath, upload.Id)
-	}
+	logger.Debug("Polling upload", "file", filePath, "upload_id", upload.Id)
 	start := time.Now()
 	sleep := 1
 	for {
-		upload.Poll(settings)
+		if err = upload.Poll(ctx, client); err != nil {
+			return fmt.Errorf("failure polling upload: %s", err), 0
+		}
 		t := time.Now()
 		if (upload.Status != "queued" && upload.Status != "processing") || int(t.Sub(start).Seconds()) > settings.UploadTimeout {
 			break
-		} else {
-			time.Sleep(time.Duration(sleep))
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err(), 0
+		case <-time.After(time.Duration(sleep) * time.Second):
 			sleep = sleep + 1
 		}
 	}
 
 	if upload.Status != "success" {
-		log.Fatalf("Upload process failed for %s: %s", filePath, upload.Status)
+		return fmt.Errorf("upload process failed for %s: %s", filePath, upload.Status), 0
 	}
 
-	return err, upload.FileId
+	return nil, upload.FileId
 }
 
-func (credentials *Credentials) UploadFile(source string) (error, Upload) {
-	// Create an uploader with the session and default options
-	uploader := s3manager.NewUploader(credentials.Session)
+func (credentials *Credentials) UploadFile(ctx context.Context, source string) (error, Upload) {
 	var upload Upload
 
 	f, err := os.Open(source)
@@ -91,115 +82,47 @@ func (credentials *Credentials) UploadFile(source string) (error, Upload) {
 	_, filename := filepath.Split(source)
 	upload.UploadKey = fmt.Sprintf("%s%s", credentials.KeyPrefix, filename)
 
-	// Upload the file to S3.
-	_, err = uploader.Upload(&s3manager.UploadInput{
-		Bucket: aws.String(credentials.Bucket),
-		Key:    aws.String(upload.UploadKey),
-		Body:   f,
-	})
+	err = credentials.Uploader.Put(ctx, upload.UploadKey, f)
 	return err, upload
 }
 
-func (credentials *Credentials) checkExpired(settings Settings) error {
+// checkExpired fetches credentials when there are none or they are about to
+// expire. A replay only has the credentials that were recorded, so it never
+// refreshes them.
+func (credentials *Credentials) checkExpired(ctx context.Context, client *Client, settings Settings) error {
 	var err error
-	if credentials.Expiration == nil || withinSeconds(credentials.Expiration, 15) {
-		err = credentials.updateCredentials(settings)
+	if credentials.Expiration == nil || (!settings.Replay && withinSeconds(credentials.Expiration, 15)) {
+		err = credentials.updateCredentials(ctx, client, settings)
 	}
 	return err
 }
 
-func (credentials *Credentials) updateCredentials(settings Settings) error {
-	if settings.Debug {
-		log.Printf("Update credentials")
-	}
-	url := fmt.Sprintf("%s/api/uploads/credentials", settings.Server)
-	req, err := http.NewRequest("POST", url, nil)
-	if err != nil {
-		log.Fatal("Error building request for Upload Credentials: ", err)
-		return err
-	}
-	req.Header.Add("Authorization", fmt.Sprintf("Token %s", settings.Token))
-	req.Header.Add("Accept", "application/vnd.api+json; com.turbosquid.api.version=1")
-	req.Header.Add("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Fatal("Error performing request for Upload Credentials: ", err)
+func (credentials *Credentials) updateCredentials(ctx context.Context, client *Client, settings Settings) error {
+	logger.Debug("Updating upload credentials")
+	if err := client.Request(ctx, "POST", "/api/uploads/credentials", nil, credentials); err != nil {
 		return err
 	}
 
-	defer resp.Body.Close()
-
-	if err = jsonapi.UnmarshalPayload(resp.Body, credentials); err != nil {
-		return err
+	// Only S3 uploads depend on the temporary credentials; other backends
+	// keep their objects across refreshes.
+	if _, isS3 := credentials.Uploader.(*S3Uploader); credentials.Uploader != nil && !isS3 {
+		return nil
 	}
-
-	credentials.Session, err = awssession.NewSession(&aws.Config{
-		Region:      aws.String(credentials.Region),
-		Credentials: awscreds.NewStaticCredentials(credentials.AccessKey, credentials.SecretKey, credentials.SessionToken),
-	})
+	var err error
+	credentials.Uploader, err = newObjectUploader(settings, credentials, client.HTTPClient.Transport)
 	return err
 }
 
-func processUpload(settings Settings, upload *Upload) error {
-	url := fmt.Sprintf("%s/api/uploads", settings.Server)
-	var message bytes.Buffer
-	if err := jsonapi.MarshalPayload(&message, upload); err != nil {
-		log.Fatal("Error building upload process message: ", err)
-		return err
-	}
-
-	req, err := http.NewRequest("POST", url, bytes.NewReader(message.Bytes()))
-	if err != nil {
-		log.Fatal("Error building request for Upload Process: ", err)
-		return err
-	}
-	req.Header.Add("Authorization", fmt.Sprintf("Token %s", settings.Token))
-	req.Header.Add("Accept", "application/vnd.api+json; com.turbosquid.api.version=1")
-	req.Header.Add("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Fatal("Error performing request for Upload Process: ", err)
-		return err
-	}
-
-	defer resp.Body.Close()
-
-	if err = jsonapi.UnmarshalPayload(resp.Body, upload); err != nil {
+func processUpload(ctx context.Context, client *Client, upload *Upload) error {
+	if err := client.Request(ctx, "POST", "/api/uploads", upload, upload); err != nil {
 		return err
 	}
-	if settings.Debug {
-		log.Printf("Upload: %s", upload.Id)
-	}
-
-	return err
+	logger.Debug("Upload queued", "upload_id", upload.Id, "status", upload.Status)
+	return nil
 }
 
-func (upload *Upload) Poll(settings Settings) error {
-	url := fmt.Sprintf("%s/api/uploads/%s", settings.Server, upload.Id)
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		log.Fatal("Error building request for Upload Poll: ", err)
-		return err
-	}
-	req.Header.Add("Authorization", fmt.Sprintf("Token %s", settings.Token))
-	req.Header.Add("Accept", "application/vnd.api+json; com.turbosquid.api.version=1")
-	req.Header.Add("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Fatal("Error performing request for Upload Poll: ", err)
-		return err
-	}
-	defer resp.Body.Close()
-
-	err = jsonapi.UnmarshalPayload(resp.Body, upload)
-
-	return err
+func (upload *Upload) Poll(ctx context.Context, client *Client) error {
+	return client.Request(ctx, "GET", fmt.Sprintf("/api/uploads/%s", upload.Id), nil, upload)
 }
 
 func withinSeconds(expiration *time.Time, seconds int) bool {
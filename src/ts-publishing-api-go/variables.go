@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// varFlags collects repeated -var key=value flags.
+type varFlags map[string]string
+
+func (vars varFlags) String() string {
+	return ""
+}
+
+func (vars varFlags) Set(value string) error {
+	separator := strings.Index(value, "=")
+	if separator < 1 {
+		return fmt.Errorf("expected key=value, got %q", value)
+	}
+	vars[value[:separator]] = value[separator+1:]
+	return nil
+}
+
+// TemplateData is what Name, Description and Tags templates can refer to,
+// e.g. {{.Polygons}}, {{.PriceUsd}}, {{join .Formats ", "}} or {{.Vars.color}}.
+type TemplateData struct {
+	Draft
+	// PriceUsd is the price in dollars, e.g. "19.99".
+	PriceUsd string
+	Files    []File
+	// Formats are the distinct formats of the product files, in file order.
+	Formats []string
+	Vars    map[string]interface{}
+}
+
+var templateFuncs = template.FuncMap{
+	"join":   strings.Join,
+	"lower":  strings.ToLower,
+	"upper":  strings.ToUpper,
+	"commas": commas,
+}
+
+// commas formats a number with thousands separators: 12345 becomes 12,345.
+func commas(n int) string {
+	digits := strconv.Itoa(n)
+	if n < 0 {
+		return "-" + commas(-n)
+	}
+	for i := len(digits) - 3; i > 0; i -= 3 {
+		digits = digits[:i] + "," + digits[i:]
+	}
+	return digits
+}
+
+// expandTemplates runs the draft's Name, Tags and Description through
+// text/template. vars from -var flags override the product's vars block.
+// Name is expanded first so the other fields can use the final name.
+func (productBundle *ProductBundle) expandTemplates(vars map[string]string) error {
+	data := TemplateData{
+		Files: productBundle.Files,
+		Vars:  map[string]interface{}{},
+	}
+	for key, value := range productBundle.Vars {
+		data.Vars[key] = value
+	}
+	for key, value := range vars {
+		data.Vars[key] = value
+	}
+	if productBundle.Draft.price().Value > 0 {
+		data.PriceUsd = formatCents(productBundle.Draft.price().Value)
+	}
+	for _, file := range productBundle.Files {
+		if file.Type == "product_file" && file.Format != "" && !containsString(data.Formats, file.Format) {
+			data.Formats = append(data.Formats, file.Format)
+		}
+	}
+
+	draft := &productBundle.Draft
+	var err error
+	data.Draft = *draft
+	if draft.Name, err = expandTemplate("name", draft.Name, data); err != nil {
+		return err
+	}
+	data.Draft = *draft
+	var tags []string
+	for i, tag := range draft.Tags {
+		expanded, err := expandTemplate(fmt.Sprintf("tags[%d]", i), tag, data)
+		if err != nil {
+			return err
+		}
+		if expanded = strings.TrimSpace(expanded); expanded != "" {
+			tags = append(tags, expanded)
+		}
+	}
+	draft.Tags = tags
+	data.Draft = *draft
+	if draft.Description, err = expandTemplate("description", draft.Description, data); err != nil {
+		return err
+	}
+	return nil
+}
+
+func expandTemplate(name string, text string, data TemplateData) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+	tmpl, err := template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid template in %s: %s", name, err)
+	}
+	var out bytes.Buffer
+	if err = tmpl.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("expanding %s: %s", name, err)
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCommas(t *testing.T) {
+	tests := []struct {
+		n    int
+		text string
+	}{
+		{0, "0"},
+		{999, "999"},
+		{1000, "1,000"},
+		{12345, "12,345"},
+		{1234567, "1,234,567"},
+		{-1234, "-1,234"},
+	}
+	for _, test := range tests {
+		if text := commas(test.n); text != test.text {
+			t.Errorf("commas(%d) = %q, want %q", test.n, text, test.text)
+		}
+	}
+}
+
+func TestExpandTemplates(t *testing.T) {
+	tests := []struct {
+		name       string
+		draft      Draft
+		bundleVars map[string]interface{}
+		vars       map[string]string
+		files      []File
+		wantName   string
+		wantTags   []string
+		wantDesc   string
+		err        bool
+	}{
+		{
+			name:       "expands vars and draft fields",
+			draft:      Draft{Name: "{{.Vars.color}} Chair", Tags: []string{"{{lower .Vars.color}}", "chair"}, Description: "{{.Name}}, {{commas .Polygons}} polygons", Polygons: 12500},
+			bundleVars: map[string]interface{}{"color": "Red"},
+			wantName:   "Red Chair",
+			wantTags:   []string{"red", "chair"},
+			wantDesc:   "Red Chair, 12,500 polygons",
+		},
+		{
+			name:       "flags override the product's vars",
+			draft:      Draft{Name: "{{.Vars.color}} Chair"},
+			bundleVars: map[string]interface{}{"color": "Red"},
+			vars:       map[string]string{"color": "Blue"},
+			wantName:   "Blue Chair",
+		},
+		{
+			name:     "drops tags that expand to nothing",
+			draft:    Draft{Name: "Chair", Tags: []string{"{{if .Vars.rigged}}rigged{{end}}", "chair"}},
+			vars:     map[string]string{"rigged": ""},
+			wantName: "Chair",
+			wantTags: []string{"chair"},
+		},
+		{
+			name:     "lists product file formats once",
+			draft:    Draft{Name: "Chair", Description: "{{join .Formats \", \"}}"},
+			files:    []File{{Type: "product_file", Format: "fbx"}, {Type: "product_file", Format: "obj"}, {Type: "product_file", Format: "fbx"}, {Type: "customer_file", Format: "zip"}},
+			wantName: "Chair",
+			wantDesc: "fbx, obj",
+		},
+		{
+			name:  "rejects missing vars",
+			draft: Draft{Name: "{{.Vars.color}} Chair"},
+			err:   true,
+		},
+		{
+			name:  "rejects invalid templates",
+			draft: Draft{Name: "{{.Vars.color"},
+			err:   true,
+		},
+	}
+	for _, test := range tests {
+		productBundle := ProductBundle{Draft: test.draft, Files: test.files, Vars: test.bundleVars}
+		err := productBundle.expandTemplates(test.vars)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expandTemplates returned no error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: expandTemplates returned %s", test.name, err)
+			continue
+		}
+		draft := productBundle.Draft
+		if draft.Name != test.wantName || draft.Description != test.wantDesc || !reflect.DeepEqual(draft.Tags, test.wantTags) {
+			t.Errorf("%s: got name %q, tags %q, description %q; want %q, %q, %q", test.name,
+				draft.Name, draft.Tags, draft.Description, test.wantName, test.wantTags, test.wantDesc)
+		}
+	}
+}
+
+func TestReadInputKeepsLargeNumbers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ts-publishing-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	product := `{"product": {"name": "{{.Vars.count}} Parts", "price_usd": "5"}, "vars": {"count": 1000000}}`
+	if err = ioutil.WriteFile(filepath.Join(dir, "product.json"), []byte(product), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if name := ReadInput(dir, nil).Draft.Name; name != "1000000 Parts" {
+		t.Errorf("name = %q, want %q", name, "1000000 Parts")
+	}
+}